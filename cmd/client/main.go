@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"flag"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/totp"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails" // decode status details
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func main() {
@@ -17,6 +23,8 @@ func main() {
 	address := flag.String("address", "localhost:50051", "gRPC server address")
 	useTLS := flag.Bool("tls", false, "Use TLS")
 	certFile := flag.String("cert", "certs/server.crt", "TLS certificate file")
+	clientID := flag.String("client-id", "", "Client service ID for the introspection test (skipped if empty)")
+	clientSecret := flag.String("client-secret", "", "Client service secret for the introspection test")
 	flag.Parse()
 
 	// Configure connection setting
@@ -38,18 +46,28 @@ func main() {
 	}
 	defer conn.Close()
 
-	// Create client
+	// Create clients
 	client := proto.NewAuthServiceClient(conn)
+	admin := proto.NewAdminServiceClient(conn)
 
 	// Create context
 	cxt, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// Client service credentials, sent as Basic authorization metadata
+	var serviceCxt context.Context
+	if *clientID != "" {
+		creds := base64.StdEncoding.EncodeToString([]byte(*clientID + ":" + *clientSecret))
+		serviceCxt = metadata.AppendToOutgoingContext(cxt, "authorization", "Basic "+creds)
+	}
+
 	// Execute test process
-	testAuthService(cxt, client)
+	testAuthService(cxt, serviceCxt, client, admin)
 }
 
-func testAuthService(ctx context.Context, client proto.AuthServiceClient) {
+// serviceCtx carries client service credentials; nil skips the
+// introspection tests
+func testAuthService(ctx, serviceCtx context.Context, client proto.AuthServiceClient, admin proto.AdminServiceClient) {
 	// User registration test
 	registerResp, err := client.Register(ctx, &proto.RegisterRequest{
 		Username: "testuser",
@@ -57,9 +75,21 @@ func testAuthService(ctx context.Context, client proto.AuthServiceClient) {
 		Password: "password123",
 	})
 	if err != nil {
-		log.Fatalf("Failed to register: %v", err)
+		// Keep going so the test can be rerun against the same server
+		logStatus("Register error", err)
+	} else {
+		log.Printf("Register response: %v", registerResp)
+	}
+
+	// Verification email resend test; the link itself arrives by email
+	resendResp, err := client.ResendVerification(ctx, &proto.ResendVerificationRequest{
+		Email: "test@example.com",
+	})
+	if err != nil {
+		logStatus("Resend verification error", err)
+	} else {
+		log.Printf("Resend verification response: %v", resendResp)
 	}
-	log.Printf("Register response: %v", registerResp)
 
 	// Login test
 	loginResp, err := client.Login(ctx, &proto.LoginRequest{
@@ -71,16 +101,14 @@ func testAuthService(ctx context.Context, client proto.AuthServiceClient) {
 	}
 	log.Printf("Login response: %v", loginResp)
 
-	// User info acquisition test
-	if loginResp.Success {
-		userInfoResp, err := client.GetUserInfo(ctx, &proto.UserInfoRequest{
-			SessionToken: loginResp.SessionToken,
-		})
-		if err != nil {
-			log.Fatalf("Failed to get user info: %v", err)
-		}
-		log.Printf("UserInfo response: %v", userInfoResp)
+	// Public key set test; empty when the server signs with HS256
+	jwksResp, err := client.GetJWKS(ctx, &proto.GetJWKSRequest{})
+	if err != nil {
+		log.Fatalf("Failed to get key set: %v", err)
 	}
+	log.Printf("GetJWKS response: %v", jwksResp)
+
+	testSessionTokens(ctx, serviceCtx, client, admin, loginResp)
 
 	// Reset password request test
 	resetReqResp, err := client.RequestPasswordReset(ctx, &proto.PasswordResetRequest{
@@ -90,19 +118,12 @@ func testAuthService(ctx context.Context, client proto.AuthServiceClient) {
 		log.Fatalf("Reset password request failed: %v", err)
 	}
 	log.Printf("Password reset request response: %v", resetReqResp)
-
-	// Reset password test
-	if resetReqResp.Success {
-		resetResp, err := client.ResetPassword(ctx, &proto.NewPasswordRequest{
-			ResetToken:  resetReqResp.SessionToken,
-			NewPassword: "newpassword456",
-		})
-		if err != nil {
-			log.Fatalf("Reset password failed: %v", err)
-		}
-		log.Printf("Reset password response: %v", resetResp)
+	if resetReqResp.SessionToken == "" {
+		log.Fatalf("No reset token returned; run the server with -dev-expose-reset-token")
 	}
 
+	testResetPassword(ctx, client, resetReqResp.SessionToken)
+
 	// Login test with new password
 	newLoginResp, err := client.Login(ctx, &proto.LoginRequest{
 		Username: "testuser",
@@ -112,4 +133,329 @@ func testAuthService(ctx context.Context, client proto.AuthServiceClient) {
 		log.Fatalf("Failed to login with new password: %v", err)
 	}
 	log.Printf("New login response: %v", newLoginResp)
+
+	testTOTP(ctx, client, newLoginResp.SessionToken)
+
+	// List sessions test
+	listResp, err := client.ListSessions(ctx, &proto.ListSessionsRequest{
+		SessionToken: newLoginResp.SessionToken,
+	})
+	if err != nil {
+		log.Fatalf("Failed to list sessions: %v", err)
+	}
+	log.Printf("List sessions response: %v", listResp)
+
+	testChangePassword(ctx, client, newLoginResp.SessionToken)
+
+	testAccountDeletion(ctx, client, newLoginResp.SessionToken)
+
+	// Logout test
+	logoutResp, err := client.Logout(ctx, &proto.LogoutRequest{
+		SessionToken: newLoginResp.SessionToken,
+	})
+	if err != nil {
+		log.Fatalf("Failed to logout: %v", err)
+	}
+	log.Printf("Logout response: %v", logoutResp)
+
+	// User info acquisition test after logout (should be rejected)
+	loggedOutResp, err := client.GetUserInfo(ctx, &proto.UserInfoRequest{
+		SessionToken: newLoginResp.SessionToken,
+	})
+	if err == nil {
+		log.Fatalf("Session token still valid after logout: %v", loggedOutResp)
+	}
+	logStatus("UserInfo error after logout", err)
+
+	// Token introspection test after logout (should be inactive)
+	if serviceCtx != nil {
+		introspectResp, err := client.Introspect(serviceCtx, &proto.IntrospectRequest{
+			Token: newLoginResp.SessionToken,
+		})
+		if err != nil {
+			log.Fatalf("Failed to introspect token: %v", err)
+		}
+		if introspectResp.Active {
+			log.Fatalf("Session token introspected as active after logout")
+		}
+		log.Printf("Introspect response after logout: %v", introspectResp)
+	}
+}
+
+// User info, introspection and refresh token tests with a fresh login
+func testSessionTokens(ctx, serviceCtx context.Context, client proto.AuthServiceClient, admin proto.AdminServiceClient, loginResp *proto.LoginResponse) {
+	userInfoResp, err := client.GetUserInfo(ctx, &proto.UserInfoRequest{
+		SessionToken: loginResp.SessionToken,
+	})
+	if err != nil {
+		log.Fatalf("Failed to get user info: %v", err)
+	}
+	log.Printf("UserInfo response: %v", userInfoResp)
+
+	// Token introspection test as a client service
+	if serviceCtx != nil {
+		introspectResp, err := client.Introspect(serviceCtx, &proto.IntrospectRequest{
+			Token: loginResp.SessionToken,
+		})
+		if err != nil {
+			log.Fatalf("Failed to introspect token: %v", err)
+		}
+		if !introspectResp.Active {
+			log.Fatalf("Valid session token introspected as inactive")
+		}
+		log.Printf("Introspect response: %v", introspectResp)
+	}
+
+	// Introspection without client credentials (should be rejected)
+	_, err = client.Introspect(ctx, &proto.IntrospectRequest{
+		Token: loginResp.SessionToken,
+	})
+	if err == nil {
+		log.Fatalf("Introspection without client credentials was accepted")
+	}
+	logStatus("Introspect error without client credentials", err)
+
+	// Admin service test as a regular user (should be rejected)
+	usersResp, err := admin.ListUsers(ctx, &proto.ListUsersRequest{
+		SessionToken: loginResp.SessionToken,
+	})
+	if err == nil {
+		log.Fatalf("Regular user was allowed to list users: %v", usersResp)
+	}
+	logStatus("ListUsers error as regular user", err)
+
+	// Refresh token test
+	refreshResp, err := client.RefreshToken(ctx, &proto.RefreshTokenRequest{
+		RefreshToken: loginResp.RefreshToken,
+	})
+	if err != nil {
+		log.Fatalf("Failed to refresh token: %v", err)
+	}
+	log.Printf("Refresh token response: %v", refreshResp)
+
+	// Refresh token reuse test (should be rejected)
+	reuseResp, err := client.RefreshToken(ctx, &proto.RefreshTokenRequest{
+		RefreshToken: loginResp.RefreshToken,
+	})
+	if err == nil {
+		log.Fatalf("Refresh token reuse was accepted: %v", reuseResp)
+	}
+	logStatus("Refresh token reuse error", err)
+}
+
+// Reset password test
+func testResetPassword(ctx context.Context, client proto.AuthServiceClient, resetToken string) {
+	resetResp, err := client.ResetPassword(ctx, &proto.NewPasswordRequest{
+		ResetToken:  resetToken,
+		NewPassword: "newpassword456",
+	})
+	if err != nil {
+		log.Fatalf("Reset password failed: %v", err)
+	}
+	log.Printf("Reset password response: %v", resetResp)
+}
+
+// TOTP test: enroll, log in with a second factor, then disable again.
+// Codes of neighbouring time steps are used since each one is accepted only once.
+func testTOTP(ctx context.Context, client proto.AuthServiceClient, sessionToken string) {
+	enrollResp, err := client.EnrollTOTP(ctx, &proto.EnrollTOTPRequest{
+		SessionToken: sessionToken,
+	})
+	if err != nil {
+		log.Fatalf("Failed to enroll TOTP: %v", err)
+	}
+	log.Printf("Enroll TOTP response: %v", enrollResp)
+
+	step := totp.Counter(time.Now())
+	code := func(offset int64) string {
+		c, err := totp.CodeAt(enrollResp.Secret, step+offset)
+		if err != nil {
+			log.Fatalf("Failed to compute TOTP code: %v", err)
+		}
+		return c
+	}
+
+	confirmResp, err := client.ConfirmTOTP(ctx, &proto.ConfirmTOTPRequest{
+		SessionToken: sessionToken,
+		Code:         code(-1),
+	})
+	if err != nil {
+		log.Fatalf("Failed to confirm TOTP: %v", err)
+	}
+	log.Printf("Confirm TOTP response: %v", confirmResp)
+
+	mfaLoginResp, err := client.Login(ctx, &proto.LoginRequest{
+		Username: "testuser",
+		Password: "newpassword456",
+	})
+	if err != nil {
+		log.Fatalf("Failed to login with MFA: %v", err)
+	}
+	if !mfaLoginResp.MfaRequired {
+		log.Fatalf("Login did not require MFA: %v", mfaLoginResp)
+	}
+	log.Printf("MFA login response: %v", mfaLoginResp)
+
+	verifyResp, err := client.VerifyMFA(ctx, &proto.VerifyMFARequest{
+		MfaToken: mfaLoginResp.MfaToken,
+		Code:     code(0),
+	})
+	if err != nil {
+		log.Fatalf("Failed to verify MFA: %v", err)
+	}
+	log.Printf("Verify MFA response: %v", verifyResp)
+
+	// Recovery code test: log in again with a recovery code instead of a TOTP code
+	_, err = client.GenerateRecoveryCodes(ctx, &proto.GenerateRecoveryCodesRequest{
+		SessionToken: verifyResp.SessionToken,
+	})
+	if err == nil {
+		log.Fatalf("Recovery codes were generated without a code or password")
+	}
+	logStatus("Generate recovery codes error without a code or password", err)
+
+	codesResp, err := client.GenerateRecoveryCodes(ctx, &proto.GenerateRecoveryCodesRequest{
+		SessionToken: verifyResp.SessionToken,
+		Password:     "newpassword456",
+	})
+	if err != nil {
+		log.Fatalf("Failed to generate recovery codes: %v", err)
+	}
+	log.Printf("Generate recovery codes response: %v", codesResp)
+
+	recoveryLoginResp, err := client.Login(ctx, &proto.LoginRequest{
+		Username: "testuser",
+		Password: "newpassword456",
+	})
+	if err != nil {
+		log.Fatalf("Failed to login with MFA: %v", err)
+	}
+	recoveryResp, err := client.VerifyMFA(ctx, &proto.VerifyMFARequest{
+		MfaToken: recoveryLoginResp.MfaToken,
+		Code:     codesResp.RecoveryCodes[0],
+	})
+	if err != nil {
+		log.Fatalf("Failed to verify MFA with recovery code: %v", err)
+	}
+	log.Printf("Verify MFA with recovery code response: %v", recoveryResp)
+
+	mfaInfoResp, err := client.GetUserInfo(ctx, &proto.UserInfoRequest{
+		SessionToken: recoveryResp.SessionToken,
+	})
+	if err != nil {
+		log.Fatalf("Failed to get user info: %v", err)
+	}
+	log.Printf("UserInfo response with MFA: %v", mfaInfoResp)
+
+	disableResp, err := client.DisableTOTP(ctx, &proto.DisableTOTPRequest{
+		SessionToken: verifyResp.SessionToken,
+		Code:         code(1),
+	})
+	if err != nil {
+		log.Fatalf("Failed to disable TOTP: %v", err)
+	}
+	log.Printf("Disable TOTP response: %v", disableResp)
+}
+
+// Change password test; ends the sessions from the TOTP test
+func testChangePassword(ctx context.Context, client proto.AuthServiceClient, sessionToken string) {
+	changeResp, err := client.ChangePassword(ctx, &proto.ChangePasswordRequest{
+		SessionToken: sessionToken,
+		OldPassword:  "newpassword456",
+		NewPassword:  "changedpassword789",
+	})
+	if err != nil {
+		log.Fatalf("Failed to change password: %v", err)
+	}
+	log.Printf("Change password response: %v", changeResp)
+
+	_, err = client.ChangePassword(ctx, &proto.ChangePasswordRequest{
+		SessionToken: sessionToken,
+		OldPassword:  "newpassword456",
+		NewPassword:  "anotherpassword012",
+	})
+	if err == nil {
+		log.Fatalf("Password change with a wrong old password was accepted")
+	}
+	logStatus("Change password error with wrong old password", err)
+
+	changedLoginResp, err := client.Login(ctx, &proto.LoginRequest{
+		Username: "testuser",
+		Password: "changedpassword789",
+	})
+	if err != nil {
+		log.Fatalf("Failed to login with changed password: %v", err)
+	}
+	log.Printf("Changed password login response: %v", changedLoginResp)
+}
+
+// Profile update and account deletion test. A throwaway user is created
+// so reruns against the same server do not collide; sessionToken belongs
+// to the main test user.
+func testAccountDeletion(ctx context.Context, client proto.AuthServiceClient, sessionToken string) {
+	name := fmt.Sprintf("throwaway%d", time.Now().UnixNano())
+	if _, err := client.Register(ctx, &proto.RegisterRequest{
+		Username: name,
+		Email:    name + "@example.com",
+		Password: "throwawaypass123",
+	}); err != nil {
+		log.Fatalf("Failed to register throwaway user: %v", err)
+	}
+
+	// Taking another account's email should be rejected, unless the server
+	// hides account existence and tells the address's owner by email instead
+	takenResp, err := client.UpdateProfile(ctx, &proto.UpdateProfileRequest{
+		SessionToken: sessionToken,
+		Email:        name + "@example.com",
+		Password:     "changedpassword789",
+	})
+	if err != nil {
+		logStatus("Update profile error with taken email", err)
+	} else {
+		log.Printf("Update profile response with taken email: %v", takenResp)
+	}
+
+	throwawayLogin, err := client.Login(ctx, &proto.LoginRequest{
+		Username: name,
+		Password: "throwawaypass123",
+	})
+	if err != nil {
+		log.Fatalf("Failed to login as throwaway user: %v", err)
+	}
+
+	name += "renamed"
+	profileResp, err := client.UpdateProfile(ctx, &proto.UpdateProfileRequest{
+		SessionToken: throwawayLogin.SessionToken,
+		Username:     name,
+		Email:        name + "@example.com",
+		Password:     "throwawaypass123",
+	})
+	if err != nil {
+		log.Fatalf("Failed to update profile: %v", err)
+	}
+	log.Printf("Update profile response: %v", profileResp)
+
+	deleteResp, err := client.DeleteAccount(ctx, &proto.DeleteAccountRequest{
+		SessionToken: throwawayLogin.SessionToken,
+		Password:     "throwawaypass123",
+	})
+	if err != nil {
+		log.Fatalf("Failed to delete account: %v", err)
+	}
+	log.Printf("Delete account response: %v", deleteResp)
+
+	_, err = client.Login(ctx, &proto.LoginRequest{
+		Username: name,
+		Password: "throwawaypass123",
+	})
+	if err == nil {
+		log.Fatalf("Deleted account could still log in")
+	}
+	logStatus("Login error after account deletion", err)
+}
+
+// Log the status code, message and details of an RPC error
+func logStatus(label string, err error) {
+	st := status.Convert(err)
+	log.Printf("%s: code=%s message=%q details=%v", label, st.Code(), st.Message(), st.Details())
 }
@@ -3,8 +3,25 @@ package main
 import (
 	"flag"
 	"log"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/automatedtomato/grpc-auth-service/internal/clientauth"
+	"github.com/automatedtomato/grpc-auth-service/internal/hashing"
+	"github.com/automatedtomato/grpc-auth-service/internal/jwt"
+	"github.com/automatedtomato/grpc-auth-service/internal/lockout"
+	"github.com/automatedtomato/grpc-auth-service/internal/mail"
+	"github.com/automatedtomato/grpc-auth-service/internal/passwordpolicy"
+	"github.com/automatedtomato/grpc-auth-service/internal/ratelimit"
+	"github.com/automatedtomato/grpc-auth-service/internal/rbac"
 	"github.com/automatedtomato/grpc-auth-service/internal/server"
+	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -13,16 +30,310 @@ func main() {
 	useTLS := flag.Bool("tls", false, "Use TLS")
 	certFile := flag.String("cert", "certs/server.crt", "TLS certificate file")
 	keyFile := flag.String("key", "certs/server.key", "TLS key file")
+	storeKind := flag.String("store", "memory", "User store backend (memory or sql)")
+	dsn := flag.String("dsn", "auth.db", "SQLite data source name, used with -store=sql")
+	jwtAlg := flag.String("jwt-alg", jwt.HS256, "Access token signing algorithm (HS256, RS256 or EdDSA)")
+	jwtKey := flag.String("jwt-key", "", "Signing key file: raw secret for HS256, PEM private key otherwise (generated if empty)")
+	jwtKeyID := flag.String("jwt-kid", "", "Key ID placed in token headers (derived from the key if empty)")
+	jwtIssuer := flag.String("jwt-issuer", "grpc-auth-service", "Issuer claim of access tokens")
+	jwtTTL := flag.Duration("jwt-ttl", 15*time.Minute, "Access token lifetime")
+	jwtKeys := flag.String("jwt-keys", "", "Encrypted file of rotating signing keys, created if missing (passphrase from the JWT_KEYS_PASSPHRASE environment variable); replaces -jwt-key")
+	jwtRotation := flag.Duration("jwt-rotation-interval", 30*24*time.Hour, "How often a new signing key takes over with -jwt-keys (0 disables rotation)")
+	jwtOverlap := flag.Duration("jwt-key-overlap", 24*time.Hour, "How long keys are published before they sign and kept after they stop, with -jwt-keys")
+	refreshTTL := flag.Duration("refresh-ttl", 30*24*time.Hour, "Refresh token lifetime (also the absolute session lifetime)")
+	mfaTTL := flag.Duration("mfa-challenge-ttl", 5*time.Minute, "Time allowed between the password step and VerifyMFA")
+	totpIssuer := flag.String("totp-issuer", "grpc-auth-service", "Issuer name shown in authenticator apps")
+	idleTimeout := flag.Duration("session-idle-timeout", 72*time.Hour, "End sessions without activity for this long (0 disables)")
+	sweepInterval := flag.Duration("session-sweep-interval", time.Minute, "How often expired sessions, refresh tokens, login attempts and rate limit buckets are removed, and deleted accounts purged")
+	purgeDelay := flag.Duration("account-purge-delay", 30*24*time.Hour, "How long accounts deleted by their owner are kept before they are purged")
+	hashAlg := flag.String("password-hash", "argon2id", "Password hashing algorithm for new hashes (argon2id or bcrypt)")
+	bcryptCost := flag.Int("bcrypt-cost", bcrypt.DefaultCost, "bcrypt cost factor")
+	argonMemory := flag.Uint("argon2-memory", 19*1024, "Argon2id memory in KiB")
+	argonTime := flag.Uint("argon2-time", 2, "Argon2id iterations")
+	argonThreads := flag.Uint("argon2-threads", 1, "Argon2id parallelism")
+	minLength := flag.Int("password-min-length", 8, "Minimum password length in characters")
+	maxLength := flag.Int("password-max-length", 128, "Maximum password length in characters")
+	minClasses := flag.Int("password-min-classes", 2, "Character classes (lower, upper, digit, symbol) a password must mix")
+	commonPasswords := flag.String("common-passwords", "", "File of common or breached passwords to reject, one per line")
+	lockThreshold := flag.Int("lockout-threshold", 5, "Consecutive failed logins before an account is locked (0 disables)")
+	lockBase := flag.Duration("lockout-duration", 30*time.Second, "First account lock duration, doubled on every further failure")
+	lockMax := flag.Duration("lockout-max-duration", time.Hour, "Longest account lock duration")
+	lockReset := flag.Duration("lockout-reset", 24*time.Hour, "Forget failed logins older than this")
+	ipLimit := flag.Int("login-ip-limit", 20, "Failed logins allowed per client IP within -login-ip-window (0 disables)")
+	ipWindow := flag.Duration("login-ip-window", 15*time.Minute, "Window for counting failed logins per client IP")
+	rpID := flag.String("webauthn-rp-id", "localhost", "WebAuthn relying party ID, the site's domain (empty disables passkeys)")
+	rpName := flag.String("webauthn-rp-name", "gRPC Auth Service", "Relying party name shown by authenticators")
+	rpOrigins := flag.String("webauthn-origins", "http://localhost:8080", "Comma-separated origins allowed to use passkeys")
+	mailerKind := flag.String("mailer", "outbox", "Email delivery (outbox or smtp)")
+	outbox := flag.String("outbox", "-", "File the outbox mailer appends messages to (- for stdout)")
+	smtpAddr := flag.String("smtp-addr", "localhost:587", "SMTP server address")
+	smtpUser := flag.String("smtp-user", "", "SMTP username (password from the SMTP_PASSWORD environment variable)")
+	mailFrom := flag.String("mail-from", "no-reply@localhost", "Sender address of account emails")
+	resetURL := flag.String("reset-url", "http://localhost:8080/", "Password reset page linked from reset emails")
+	verifyURL := flag.String("verify-url", "http://localhost:8080/", "Email verification page linked from verification emails")
+	requireVerifiedEmail := flag.Bool("require-verified-email", false, "Refuse logins until the account's email address is verified")
+	hideAccounts := flag.Bool("hide-account-existence", false, "Answer registration, password reset and verification requests the same whether or not the email has an account")
+	hiddenResponseTime := flag.Duration("hidden-response-time", 250*time.Millisecond, "Minimum response time of those requests with -hide-account-existence")
+	exposeResetToken := flag.Bool("dev-expose-reset-token", false, "Return reset tokens in RequestPasswordReset responses (development only)")
+	rateLimit := flag.Bool("rate-limit", true, "Limit request rates per client IP, method and user")
+	rateLimitFile := flag.String("rate-limits", "", "JSON file of per-RPC rate limits (built-in defaults if empty)")
+	rbacPolicyFile := flag.String("rbac-policy", "", "JSON file of roles, permissions and per-RPC required permissions (built-in defaults if empty)")
+	adminUserIDs := flag.String("admin-user-ids", "", "Comma-separated IDs of users given the admin role when they log in")
+	clientsFile := flag.String("clients", "", "JSON file of client services allowed to call Introspect (introspection disabled if empty)")
+	trustedProxies := flag.String("trusted-proxies", "", "Comma-separated addresses or CIDR ranges of proxies, such as the web proxy, whose forwarded client IPs are trusted")
 	flag.Parse()
 
+	// Create stores
+	var (
+		userStore       storage.UserStore
+		refreshStore    storage.RefreshTokenStore
+		sessionStore    storage.SessionStore
+		credentialStore storage.CredentialStore
+	)
+	switch *storeKind {
+	case "memory":
+		userStore = storage.NewInMemoryUserStore()
+		refreshStore = storage.NewInMemoryRefreshTokenStore()
+		sessionStore = storage.NewInMemorySessionStore(*idleTimeout)
+		credentialStore = storage.NewInMemoryCredentialStore()
+	case "sql":
+		db, err := storage.OpenSQLite(*dsn)
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		userStore = storage.NewSQLUserStore(db)
+		refreshStore = storage.NewSQLRefreshTokenStore(db)
+		sessionStore = storage.NewSQLSessionStore(db, *idleTimeout)
+		credentialStore = storage.NewSQLCredentialStore(db)
+	default:
+		log.Fatalf("Unknown store backend: %s", *storeKind)
+	}
+
+	// Create token issuer
+	tokenCfg := jwt.Config{
+		Algorithm: *jwtAlg,
+		KeyID:     *jwtKeyID,
+		Issuer:    *jwtIssuer,
+		TTL:       *jwtTTL,
+	}
+	if *jwtKeys != "" {
+		if *jwtKey != "" {
+			log.Fatalf("-jwt-key and -jwt-keys cannot be used together")
+		}
+		// Verifiers must see a new key before it signs anything
+		if *jwtRotation > 0 && *jwtOverlap <= jwt.JWKSMaxAge {
+			log.Fatalf("-jwt-key-overlap must be longer than the %s key set cache time", jwt.JWKSMaxAge)
+		}
+		keys, err := jwt.NewKeyManager(jwt.KeyManagerConfig{
+			Algorithm:        *jwtAlg,
+			Path:             *jwtKeys,
+			Passphrase:       []byte(os.Getenv("JWT_KEYS_PASSPHRASE")),
+			RotationInterval: *jwtRotation,
+			Overlap:          *jwtOverlap,
+		})
+		if err != nil {
+			log.Fatalf("Failed to load signing keys: %v", err)
+		}
+		tokenCfg.Keys = keys
+	} else if err := tokenCfg.LoadKey(*jwtKey); err != nil {
+		log.Fatalf("Failed to load signing key: %v", err)
+	}
+	tokenIssuer, err := jwt.NewIssuer(tokenCfg)
+	if err != nil {
+		log.Fatalf("Failed to create token issuer: %v", err)
+	}
+
+	// Create password hasher. Existing hashes of other algorithms or weaker
+	// parameters are upgraded on the next successful login.
+	var hasher hashing.Hasher
+	switch *hashAlg {
+	case "argon2id":
+		argon := hashing.NewArgon2idHasher()
+		argon.Memory = uint32(*argonMemory)
+		argon.Iterations = uint32(*argonTime)
+		argon.Parallelism = uint8(*argonThreads)
+		hasher = argon
+	case "bcrypt":
+		hasher = hashing.NewBcryptHasher(*bcryptCost)
+	default:
+		log.Fatalf("Unknown password hash algorithm: %s", *hashAlg)
+	}
+
+	// Create password policy
+	policy := passwordpolicy.NewPolicy()
+	policy.MinLength = *minLength
+	policy.MaxLength = *maxLength
+	policy.MinCharClasses = *minClasses
+	if *hashAlg == "bcrypt" {
+		policy.MaxBytes = passwordpolicy.BcryptMaxBytes
+	}
+	if *commonPasswords != "" {
+		if err := policy.LoadCommonPasswords(*commonPasswords); err != nil {
+			log.Fatalf("Failed to load common passwords: %v", err)
+		}
+	}
+
+	// Create brute-force protection
+	lockPolicy := lockout.Policy{
+		Threshold:    *lockThreshold,
+		BaseDuration: *lockBase,
+		MaxDuration:  *lockMax,
+		ResetAfter:   *lockReset,
+	}
+	loginAttempts := lockout.NewIPTracker(*ipLimit, *ipWindow)
+
+	// Create passkey relying party
+	var relyingParty *webauthn.WebAuthn
+	if *rpID != "" {
+		relyingParty, err = webauthn.New(&webauthn.Config{
+			RPID:          *rpID,
+			RPDisplayName: *rpName,
+			RPOrigins:     strings.Split(*rpOrigins, ","),
+		})
+		if err != nil {
+			log.Fatalf("Failed to configure passkeys: %v", err)
+		}
+	}
+
+	// Create mailer
+	var mailer mail.Mailer
+	switch *mailerKind {
+	case "outbox":
+		mailer, err = mail.NewOutboxMailer(*outbox, *mailFrom)
+		if err != nil {
+			log.Fatalf("Failed to open outbox: %v", err)
+		}
+	case "smtp":
+		mailer = mail.NewSMTPMailer(*smtpAddr, *mailFrom, *smtpUser, os.Getenv("SMTP_PASSWORD"))
+	default:
+		log.Fatalf("Unknown mailer: %s", *mailerKind)
+	}
+	if *exposeResetToken {
+		log.Printf("WARNING: reset tokens are returned to clients (-dev-expose-reset-token)")
+		if *hideAccounts {
+			log.Printf("-dev-expose-reset-token has no effect with -hide-account-existence")
+		}
+	}
+
+	// Load access control policy
+	accessPolicy := rbac.DefaultPolicy()
+	if *rbacPolicyFile != "" {
+		if accessPolicy, err = rbac.LoadPolicy(*rbacPolicyFile); err != nil {
+			log.Fatalf("Failed to load access policy: %v", err)
+		}
+	}
+	var admins []string
+	if *adminUserIDs != "" {
+		for _, entry := range strings.Split(*adminUserIDs, ",") {
+			if id := strings.TrimSpace(entry); id != "" {
+				admins = append(admins, id)
+			}
+		}
+	}
+
+	var proxies []netip.Prefix
+	if *trustedProxies != "" {
+		for _, entry := range strings.Split(*trustedProxies, ",") {
+			prefix, err := parsePrefix(strings.TrimSpace(entry))
+			if err != nil {
+				log.Fatalf("Invalid trusted proxy %q: %v", entry, err)
+			}
+			proxies = append(proxies, prefix)
+		}
+	}
+
+	var clients *clientauth.Registry
+	if *clientsFile != "" {
+		if clients, err = clientauth.LoadRegistry(*clientsFile); err != nil {
+			log.Fatalf("Failed to load client services: %v", err)
+		}
+	}
+
+	// Create rate limiter
+	var (
+		limiter    ratelimit.Limiter
+		rateLimits *ratelimit.Config
+	)
+	if *rateLimit {
+		limiter = ratelimit.NewMemoryLimiter()
+		rateLimits = ratelimit.DefaultConfig()
+		if *rateLimitFile != "" {
+			if rateLimits, err = ratelimit.LoadConfig(*rateLimitFile); err != nil {
+				log.Fatalf("Failed to load rate limits: %v", err)
+			}
+		}
+	}
+
 	// Create server
-	grpcServer, err := server.NewGRPCServer(*useTLS, *certFile, *keyFile)
+	grpcServer, err := server.NewGRPCServer(server.Config{
+		UseTLS:            *useTLS,
+		CertFile:          *certFile,
+		KeyFile:           *keyFile,
+		UserStore:         userStore,
+		RefreshTokenStore: refreshStore,
+		SessionStore:      sessionStore,
+		CredentialStore:   credentialStore,
+		TokenIssuer:       tokenIssuer,
+		PasswordHasher:    hasher,
+		PasswordPolicy:    policy,
+		RefreshTokenTTL:   *refreshTTL,
+		MFAChallengeTTL:   *mfaTTL,
+		TOTPIssuer:        *totpIssuer,
+
+		SessionSweepInterval: *sweepInterval,
+		AccountPurgeDelay:    *purgeDelay,
+
+		Lockout:       lockPolicy,
+		LoginAttempts: loginAttempts,
+
+		Mailer:               mailer,
+		ResetURL:             *resetURL,
+		ExposeResetToken:     *exposeResetToken,
+		VerifyURL:            *verifyURL,
+		RequireVerifiedEmail: *requireVerifiedEmail,
+		HideAccountExistence: *hideAccounts,
+		HiddenResponseTime:   *hiddenResponseTime,
+
+		WebAuthn: relyingParty,
+
+		AccessPolicy: accessPolicy,
+		AdminUserIDs: admins,
+
+		Clients: clients,
+
+		TrustedProxies: proxies,
+
+		RateLimiter: limiter,
+		RateLimits:  rateLimits,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create gRPC server: %v", err)
 	}
 
+	// Shut down gracefully on interrupt
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		log.Printf("Shutting down gRPC server")
+		grpcServer.Stop()
+	}()
+
 	// Launch server
 	if err := grpcServer.Start(*address); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// Parse a CIDR range, or a single address as a range of one
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,30 @@
+package hashing
+
+import (
+	"errors"
+	"strings"
+)
+
+// Hashes passwords with one algorithm and parameter set. Encoded hashes are
+// self-describing (PHC string format for Argon2id, modular crypt format for
+// bcrypt), so any of them can be checked with Verify regardless of which
+// Hasher is currently configured.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Whether encoded was produced by another algorithm or with weaker
+	// parameters than this hasher uses
+	NeedsRehash(encoded string) bool
+}
+
+var ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+
+// Check password against an encoded hash produced by any supported algorithm
+func Verify(password, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, argon2idPrefix):
+		return verifyArgon2id(password, encoded)
+	case isBcrypt(encoded):
+		return verifyBcrypt(password, encoded)
+	}
+	return false, ErrUnknownAlgorithm
+}
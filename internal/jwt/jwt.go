@@ -0,0 +1,238 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// Token issuer configuration
+type Config struct {
+	Algorithm string
+	KeyID     string
+	Issuer    string
+	TTL       time.Duration
+
+	// Shared secret, used with HS256
+	Secret []byte
+	// Private key, used with RS256 (*rsa.PrivateKey) and EdDSA (ed25519.PrivateKey)
+	PrivateKey crypto.Signer
+
+	// Rotating keys. When set, Algorithm, KeyID, Secret and PrivateKey are
+	// ignored.
+	Keys *KeyManager
+}
+
+// Claims carried by access tokens
+type Claims struct {
+	Username  string   `json:"username"`
+	SessionID string   `json:"sid"`
+	Roles     []string `json:"roles,omitempty"`
+	gojwt.RegisteredClaims
+}
+
+// Issues and verifies signed access tokens
+type Issuer struct {
+	cfg  Config
+	keys *KeyManager
+}
+
+func NewIssuer(cfg Config) (*Issuer, error) {
+	if cfg.TTL <= 0 {
+		return nil, errors.New("token TTL must be positive")
+	}
+
+	keys := cfg.Keys
+	if keys == nil {
+		key, err := newKey(cfg.Algorithm, cfg.KeyID, cfg.Secret, cfg.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = StaticKeys(key)
+	} else if keys.cfg.RotationInterval > 0 && keys.cfg.Overlap < cfg.TTL {
+		// Tokens signed just before a rotation must stay verifiable
+		return nil, errors.New("key overlap must be at least the token TTL")
+	}
+	return &Issuer{cfg: cfg, keys: keys}, nil
+}
+
+// Signing keys of the issuer
+func (i *Issuer) Keys() *KeyManager {
+	return i.keys
+}
+
+// Issue a signed access token for the user's session
+func (i *Issuer) Issue(userID, username, sessionID string, roles []string) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
+		Username:  username,
+		SessionID: sessionID,
+		Roles:     roles,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			Issuer:    i.cfg.Issuer,
+			Subject:   userID,
+			IssuedAt:  gojwt.NewNumericDate(now),
+			ExpiresAt: gojwt.NewNumericDate(now.Add(i.cfg.TTL)),
+		},
+	}
+
+	signed, err := i.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// Audience of MFA challenge tokens. Access tokens carry no audience, which
+// keeps the two from being used in place of each other.
+const challengeAudience = "mfa"
+
+// Verify signature, key ID, issuer and expiry of an access token
+func (i *Issuer) Verify(tokenString string) (*Claims, error) {
+	claims, err := i.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("not an access token")
+	}
+	return claims, nil
+}
+
+// Issue a short-lived token proving the user passed the password step of a
+// login that still requires a second factor
+func (i *Issuer) IssueChallenge(userID, username string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &Claims{
+		Username: username,
+		RegisteredClaims: gojwt.RegisteredClaims{
+			Issuer:    i.cfg.Issuer,
+			Subject:   userID,
+			Audience:  gojwt.ClaimStrings{challengeAudience},
+			IssuedAt:  gojwt.NewNumericDate(now),
+			ExpiresAt: gojwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	return i.sign(claims)
+}
+
+// Sign claims with the current key
+func (i *Issuer) sign(claims *Claims) (string, error) {
+	key := i.keys.Current()
+	token := gojwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey())
+}
+
+// Verify an MFA challenge token
+func (i *Issuer) VerifyChallenge(tokenString string) (*Claims, error) {
+	return i.parse(tokenString, gojwt.WithAudience(challengeAudience))
+}
+
+func (i *Issuer) parse(tokenString string, opts ...gojwt.ParserOption) (*Claims, error) {
+	claims := &Claims{}
+	opts = append([]gojwt.ParserOption{
+		gojwt.WithIssuer(i.cfg.Issuer),
+		gojwt.WithExpirationRequired(),
+		gojwt.WithIssuedAt(),
+	}, opts...)
+	_, err := gojwt.ParseWithClaims(tokenString, claims, func(token *gojwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key := i.keys.Lookup(kid)
+		if key == nil {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		// Each key only verifies its own algorithm
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+		}
+		return key.verifyKey(), nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// Load the signing key for cfg.Algorithm from path. With an empty path a
+// random key is generated, which means tokens do not survive a restart.
+func (cfg *Config) LoadKey(path string) error {
+	if path == "" {
+		log.Printf("WARNING: no %s signing key configured, generating an ephemeral one", cfg.Algorithm)
+		return cfg.generateKey()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Algorithm == HS256 {
+		cfg.Secret = data
+		return nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("%s: no PEM data found", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		// Fall back to the traditional "RSA PRIVATE KEY" encoding
+		rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if rsaErr != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		key = rsaKey
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("%s: unsupported private key type %T", path, key)
+	}
+	cfg.PrivateKey = signer
+	return nil
+}
+
+func (cfg *Config) generateKey() error {
+	var err error
+	cfg.Secret, cfg.PrivateKey, err = generateKeyMaterial(cfg.Algorithm)
+	return err
+}
+
+// Derive a stable key ID from the verification key
+func keyID(verifyKey any) (string, error) {
+	var material []byte
+	switch key := verifyKey.(type) {
+	case []byte:
+		material = key
+	default:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return "", err
+		}
+		material = der
+	}
+	sum := sha256.Sum256(material)
+	return base64.RawURLEncoding.EncodeToString(sum[:8]), nil
+}
@@ -0,0 +1,203 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// On-disk form of the key set: the keys as JSON, sealed with AES-256-GCM
+// under a key derived from the passphrase with Argon2id
+type keyFile struct {
+	Version    int       `json:"version"`
+	KDF        kdfParams `json:"kdf"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+type kdfParams struct {
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // KiB
+	Threads uint8  `json:"threads"`
+}
+
+type storedKey struct {
+	ID        string    `json:"kid"`
+	Algorithm string    `json:"alg"`
+	CreatedAt time.Time `json:"created_at"`
+	NotBefore time.Time `json:"not_before"`
+	// Raw secret for HS256, PKCS#8 DER private key otherwise
+	Material []byte `json:"key"`
+}
+
+const keyFileVersion = 1
+
+func (p kdfParams) key(passphrase []byte) []byte {
+	return argon2.IDKey(passphrase, p.Salt, p.Time, p.Memory, p.Threads, 32)
+}
+
+// Read and decrypt a key file. A missing file is reported as fs.ErrNotExist.
+func readKeyFile(path string, passphrase []byte) ([]*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f keyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if f.Version != keyFileVersion {
+		return nil, fmt.Errorf("%s: unsupported key file version %d", path, f.Version)
+	}
+
+	gcm, err := newGCM(f.KDF.key(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%s: malformed nonce", path)
+	}
+	plaintext, err := gcm.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: wrong passphrase or corrupted key file", path)
+	}
+
+	var stored []storedKey
+	if err := json.Unmarshal(plaintext, &stored); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	keys := make([]*Key, 0, len(stored))
+	for _, s := range stored {
+		key, err := s.key()
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %s: %w", path, s.ID, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Encrypt keys under a fresh salt and nonce and replace the file at path
+func writeKeyFile(path string, passphrase []byte, keys []*Key) error {
+	stored := make([]storedKey, 0, len(keys))
+	for _, key := range keys {
+		s, err := storeKey(key)
+		if err != nil {
+			return err
+		}
+		stored = append(stored, s)
+	}
+	plaintext, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	f := keyFile{
+		Version: keyFileVersion,
+		KDF: kdfParams{
+			Salt:    make([]byte, 16),
+			Time:    3,
+			Memory:  64 * 1024,
+			Threads: 4,
+		},
+	}
+	if _, err := rand.Read(f.KDF.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(f.KDF.key(passphrase))
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Ciphertext = gcm.Seal(nil, f.Nonce, plaintext, nil)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write a temporary file and rename it over the old one, so a crash
+	// never leaves a partly written key file behind
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func storeKey(key *Key) (storedKey, error) {
+	s := storedKey{
+		ID:        key.ID,
+		Algorithm: key.Algorithm,
+		CreatedAt: key.CreatedAt,
+		NotBefore: key.NotBefore,
+	}
+	if key.Algorithm == HS256 {
+		s.Material = key.secret
+		return s, nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return storedKey{}, err
+	}
+	s.Material = der
+	return s, nil
+}
+
+func (s storedKey) key() (*Key, error) {
+	var (
+		secret  []byte
+		private crypto.Signer
+	)
+	if s.Algorithm == HS256 {
+		secret = s.Material
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(s.Material)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", parsed)
+		}
+		private = signer
+	}
+
+	key, err := newKey(s.Algorithm, s.ID, secret, private)
+	if err != nil {
+		return nil, err
+	}
+	key.CreatedAt = s.CreatedAt
+	key.NotBefore = s.NotBefore
+	return key, nil
+}
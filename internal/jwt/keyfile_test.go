@@ -0,0 +1,76 @@
+package jwt
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	passphrase := []byte("correct horse battery staple")
+
+	var keys []*Key
+	notBefore := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, alg := range []string{HS256, RS256, EdDSA} {
+		key, err := generateKey(alg, notBefore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		notBefore = notBefore.Add(time.Hour)
+	}
+
+	if err := writeKeyFile(path, passphrase, keys); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := readKeyFile(path, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != len(keys) {
+		t.Fatalf("read %d keys, want %d", len(loaded), len(keys))
+	}
+	for i, want := range keys {
+		got := loaded[i]
+		if got.ID != want.ID || got.Algorithm != want.Algorithm || !got.NotBefore.Equal(want.NotBefore) {
+			t.Errorf("key %d = %s %s %s, want %s %s %s", i,
+				got.ID, got.Algorithm, got.NotBefore, want.ID, want.Algorithm, want.NotBefore)
+		}
+		gotStored, err := storeKey(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantStored, err := storeKey(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotStored.Material, wantStored.Material) {
+			t.Errorf("key %d: key material differs after reading it back", i)
+		}
+	}
+}
+
+func TestKeyFileWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	key, err := generateKey(EdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKeyFile(path, []byte("right passphrase"), []*Key{key}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readKeyFile(path, []byte("wrong passphrase")); err == nil {
+		t.Fatal("key file decrypted with a wrong passphrase")
+	}
+	if _, err := NewKeyManager(KeyManagerConfig{
+		Algorithm:  EdDSA,
+		Path:       path,
+		Passphrase: []byte("wrong passphrase"),
+	}); err == nil {
+		t.Fatal("key manager loaded a key file with a wrong passphrase")
+	}
+}
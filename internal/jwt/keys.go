@@ -0,0 +1,314 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// Signing key with its key ID
+type Key struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	// When the key starts signing tokens. Until then it is only published,
+	// so verifiers can pick it up ahead of time.
+	NotBefore time.Time
+
+	secret  []byte        // HS256
+	private crypto.Signer // RS256 (*rsa.PrivateKey) and EdDSA (ed25519.PrivateKey)
+}
+
+// Build a key from key material, checking that it suits alg. An empty id is
+// derived from the verification key.
+func newKey(alg, id string, secret []byte, private crypto.Signer) (*Key, error) {
+	k := &Key{ID: id, Algorithm: alg}
+	switch alg {
+	case HS256:
+		if len(secret) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 bytes")
+		}
+		k.secret = secret
+	case RS256:
+		if _, ok := private.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("RS256 requires an RSA private key")
+		}
+		k.private = private
+	case EdDSA:
+		if _, ok := private.(ed25519.PrivateKey); !ok {
+			return nil, errors.New("EdDSA requires an Ed25519 private key")
+		}
+		k.private = private
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	if k.ID == "" {
+		kid, err := keyID(k.verifyKey())
+		if err != nil {
+			return nil, err
+		}
+		k.ID = kid
+	}
+	return k, nil
+}
+
+// Generate a random key for alg that starts signing at notBefore
+func generateKey(alg string, notBefore time.Time) (*Key, error) {
+	secret, private, err := generateKeyMaterial(alg)
+	if err != nil {
+		return nil, err
+	}
+	k, err := newKey(alg, "", secret, private)
+	if err != nil {
+		return nil, err
+	}
+	k.CreatedAt = time.Now()
+	k.NotBefore = notBefore
+	return k, nil
+}
+
+func (k *Key) method() gojwt.SigningMethod {
+	return gojwt.GetSigningMethod(k.Algorithm)
+}
+
+func (k *Key) signKey() any {
+	if k.Algorithm == HS256 {
+		return k.secret
+	}
+	return k.private
+}
+
+func (k *Key) verifyKey() any {
+	if k.Algorithm == HS256 {
+		return k.secret
+	}
+	return k.private.Public()
+}
+
+// Public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 curve and public key
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// How long verifiers may cache the published key set. New keys are
+// published one overlap before they sign, which has to be longer than this.
+const JWKSMaxAge = 5 * time.Minute
+
+// JWK of the key's public half; false for HS256 keys, which are secret
+func (k *Key) JWK() (JWK, bool) {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+	switch pub := k.verifyKey().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// Key manager configuration
+type KeyManagerConfig struct {
+	Algorithm string
+	// Encrypted key file. Empty keeps keys in memory only, so they do not
+	// survive a restart.
+	Path       string
+	Passphrase []byte
+	// How often a new key takes over signing; 0 disables rotation
+	RotationInterval time.Duration
+	// How long a new key is published before it signs, and an old key kept
+	// for verification after it stops signing. Must cover the token TTL.
+	Overlap time.Duration
+}
+
+// Holds the signing keys. The newest active key signs; every key held
+// verifies and is published.
+type KeyManager struct {
+	cfg KeyManagerConfig
+
+	mu   sync.RWMutex
+	keys []*Key // ordered by NotBefore
+}
+
+// Load the keys from cfg.Path, creating the file with a first key if it
+// does not exist, and bring them up to date with the rotation schedule
+func NewKeyManager(cfg KeyManagerConfig) (*KeyManager, error) {
+	switch cfg.Algorithm {
+	case HS256, RS256, EdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.Algorithm)
+	}
+	if cfg.RotationInterval > 0 && cfg.RotationInterval <= cfg.Overlap {
+		return nil, errors.New("key rotation interval must be longer than the overlap")
+	}
+	if cfg.Path != "" && len(cfg.Passphrase) == 0 {
+		return nil, errors.New("a passphrase is required to store keys")
+	}
+
+	m := &KeyManager{cfg: cfg}
+	if cfg.Path != "" {
+		keys, err := readKeyFile(cfg.Path, cfg.Passphrase)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		m.keys = keys
+	}
+	if _, err := m.Rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Key manager holding a single key that never rotates
+func StaticKeys(key *Key) *KeyManager {
+	return &KeyManager{
+		cfg:  KeyManagerConfig{Algorithm: key.Algorithm},
+		keys: []*Key{key},
+	}
+}
+
+// Key that signs at now: the one with the latest NotBefore not after now
+func activeKey(keys []*Key, now time.Time) (*Key, int) {
+	for i := len(keys) - 1; i >= 0; i-- {
+		if !keys[i].NotBefore.After(now) {
+			return keys[i], i
+		}
+	}
+	return nil, -1
+}
+
+// Bring the keys up to date at now: publish the next key one overlap before
+// it is due, and drop keys superseded more than one overlap ago. Changes are
+// saved before they take effect. Reports whether anything changed.
+func (m *KeyManager) Rotate(now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := slices.Clone(m.keys)
+	changed := false
+
+	current, i := activeKey(keys, now)
+	switch {
+	case current == nil || current.Algorithm != m.cfg.Algorithm:
+		// First key, or the algorithm was changed: a new key signs right
+		// away, replacing any pending one
+		keys = keys[:i+1]
+		key, err := generateKey(m.cfg.Algorithm, now)
+		if err != nil {
+			return false, err
+		}
+		keys = append(keys, key)
+		changed = true
+	case m.cfg.RotationInterval > 0 && i == len(keys)-1:
+		due := current.NotBefore.Add(m.cfg.RotationInterval)
+		if !now.Before(due.Add(-m.cfg.Overlap)) {
+			// After downtime the next key may be overdue; it is still
+			// published for a full overlap first
+			if earliest := now.Add(m.cfg.Overlap); due.Before(earliest) {
+				due = earliest
+			}
+			key, err := generateKey(m.cfg.Algorithm, due)
+			if err != nil {
+				return false, err
+			}
+			keys = append(keys, key)
+			changed = true
+		}
+	}
+
+	// A key is superseded once its successor signs
+	for len(keys) > 1 && !now.Before(keys[1].NotBefore.Add(m.cfg.Overlap)) {
+		keys = keys[1:]
+		changed = true
+	}
+
+	if !changed {
+		return false, nil
+	}
+	if m.cfg.Path != "" {
+		if err := writeKeyFile(m.cfg.Path, m.cfg.Passphrase, keys); err != nil {
+			return false, err
+		}
+	}
+	m.keys = keys
+	return true, nil
+}
+
+// Key signing new tokens
+func (m *KeyManager) Current() *Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, _ := activeKey(m.keys, time.Now())
+	return key
+}
+
+// Key with the given ID, nil if there is none
+func (m *KeyManager) Lookup(id string) *Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.keys {
+		if key.ID == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// Public keys of all keys held, pending and retiring ones included. Empty
+// for HS256.
+func (m *KeyManager) PublicKeys() []JWK {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var jwks []JWK
+	for _, key := range m.keys {
+		if jwk, ok := key.JWK(); ok {
+			jwks = append(jwks, jwk)
+		}
+	}
+	return jwks
+}
+
+// Random key material for alg
+func generateKeyMaterial(alg string) (secret []byte, private crypto.Signer, err error) {
+	switch alg {
+	case HS256:
+		secret = make([]byte, 32)
+		_, err = rand.Read(secret)
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return secret, private, err
+}
@@ -0,0 +1,135 @@
+package jwt
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Rotation schedule used by the tests: a new key every 10 hours, published
+// 2 hours before it signs
+func testKeyManager() *KeyManager {
+	return &KeyManager{cfg: KeyManagerConfig{
+		Algorithm:        EdDSA,
+		RotationInterval: 10 * time.Hour,
+		Overlap:          2 * time.Hour,
+	}}
+}
+
+func rotate(t *testing.T, m *KeyManager, now time.Time, wantChanged bool) {
+	t.Helper()
+	changed, err := m.Rotate(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != wantChanged {
+		t.Fatalf("Rotate(%s) changed = %v, want %v", now.Format(time.RFC3339), changed, wantChanged)
+	}
+}
+
+func published(m *KeyManager, id string) bool {
+	for _, jwk := range m.PublicKeys() {
+		if jwk.Kid == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRotatePublishesNextKeyOneOverlapEarly(t *testing.T) {
+	m := testKeyManager()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rotate(t, m, t0, true)
+	first := m.keys[0]
+
+	// Nothing to do until one overlap before the next key is due
+	rotate(t, m, t0.Add(8*time.Hour-time.Second), false)
+
+	rotate(t, m, t0.Add(8*time.Hour), true)
+	if len(m.keys) != 2 {
+		t.Fatalf("%d keys held, want 2", len(m.keys))
+	}
+	next := m.keys[1]
+	if want := t0.Add(10 * time.Hour); !next.NotBefore.Equal(want) {
+		t.Errorf("next key signs from %s, want %s", next.NotBefore, want)
+	}
+	if !published(m, next.ID) {
+		t.Error("next key not published ahead of time")
+	}
+	if key, _ := activeKey(m.keys, t0.Add(8*time.Hour)); key != first {
+		t.Error("next key signs before it is due")
+	}
+	if key, _ := activeKey(m.keys, t0.Add(10*time.Hour)); key != next {
+		t.Error("next key does not sign once it is due")
+	}
+}
+
+func TestRotateDropsRetiredKeyAfterOverlap(t *testing.T) {
+	m := testKeyManager()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rotate(t, m, t0, true)
+	first := m.keys[0]
+	rotate(t, m, t0.Add(8*time.Hour), true)
+
+	// The old key keeps verifying for one overlap after it stops signing
+	rotate(t, m, t0.Add(12*time.Hour-time.Second), false)
+	if m.Lookup(first.ID) == nil {
+		t.Fatal("retired key dropped before the overlap ended")
+	}
+
+	rotate(t, m, t0.Add(12*time.Hour), true)
+	if m.Lookup(first.ID) != nil {
+		t.Error("retired key still held after the overlap")
+	}
+	if published(m, first.ID) {
+		t.Error("retired key still published after the overlap")
+	}
+	if len(m.keys) != 1 {
+		t.Errorf("%d keys held, want 1", len(m.keys))
+	}
+}
+
+func TestRotateOverdueKeyGetsFullOverlap(t *testing.T) {
+	m := testKeyManager()
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	rotate(t, m, t0, true)
+	first := m.keys[0]
+
+	// The server was down past the time the next key was due
+	restart := t0.Add(50 * time.Hour)
+	rotate(t, m, restart, true)
+	if len(m.keys) != 2 {
+		t.Fatalf("%d keys held, want 2", len(m.keys))
+	}
+	next := m.keys[1]
+	if want := restart.Add(2 * time.Hour); !next.NotBefore.Equal(want) {
+		t.Errorf("overdue key signs from %s, want %s", next.NotBefore, want)
+	}
+	if key, _ := activeKey(m.keys, restart); key != first {
+		t.Error("overdue key signs before verifiers could pick it up")
+	}
+}
+
+func TestKeyManagerReloadsKeyFile(t *testing.T) {
+	cfg := KeyManagerConfig{
+		Algorithm:        EdDSA,
+		Path:             filepath.Join(t.TempDir(), "keys.json"),
+		Passphrase:       []byte("correct horse battery staple"),
+		RotationInterval: 10 * time.Hour,
+		Overlap:          2 * time.Hour,
+	}
+	m, err := NewKeyManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewKeyManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reloaded.Current().ID, m.Current().ID; got != want {
+		t.Errorf("reloaded signing key %s, want %s", got, want)
+	}
+}
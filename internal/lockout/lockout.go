@@ -0,0 +1,132 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+)
+
+// Per-account lockout with exponential backoff. Once an account reaches
+// Threshold consecutive failures it is locked for BaseDuration, doubling with
+// every further failure up to MaxDuration.
+type Policy struct {
+	Threshold    int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+	// Failures older than this are forgotten
+	ResetAfter time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Threshold:    5,
+		BaseDuration: 30 * time.Second,
+		MaxDuration:  time.Hour,
+		ResetAfter:   24 * time.Hour,
+	}
+}
+
+// How long to lock an account after its failures-th consecutive failure
+func (p Policy) LockDuration(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+	d := p.BaseDuration
+	for i := p.Threshold; i < failures; i++ {
+		d *= 2
+		if d >= p.MaxDuration {
+			return p.MaxDuration
+		}
+	}
+	return d
+}
+
+// Count a failed login against the user, locking the account when the
+// threshold is reached. The caller must hold the user exclusively, as the
+// in-memory user store does under its lock.
+func (p Policy) RecordFailure(user *model.User) {
+	now := time.Now()
+	if p.ResetAfter > 0 && now.Sub(user.LastFailedLogin) > p.ResetAfter {
+		user.FailedLoginAttempts = 0
+	}
+	user.FailedLoginAttempts++
+	user.LastFailedLogin = now
+	if d := p.LockDuration(user.FailedLoginAttempts); d > 0 {
+		user.LockedUntil = now.Add(d)
+	}
+}
+
+// Counts failed logins per client IP in a fixed window, independent of the
+// account targeted, to slow down password spraying
+type IPTracker struct {
+	limit   int
+	window  time.Duration
+	entries map[string]*ipEntry
+	mu      sync.Mutex
+}
+
+type ipEntry struct {
+	failures    int
+	windowStart time.Time
+}
+
+// Limit of 0 disables per-IP tracking
+func NewIPTracker(limit int, window time.Duration) *IPTracker {
+	return &IPTracker{
+		limit:   limit,
+		window:  window,
+		entries: make(map[string]*ipEntry),
+	}
+}
+
+// Whether ip has exceeded the failure limit, and how long until it may retry
+func (t *IPTracker) Blocked(ip string) (time.Duration, bool) {
+	if t.limit <= 0 || ip == "" {
+		return 0, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, exists := t.entries[ip]
+	if !exists {
+		return 0, false
+	}
+	remaining := time.Until(entry.windowStart.Add(t.window))
+	if remaining <= 0 {
+		delete(t.entries, ip)
+		return 0, false
+	}
+	return remaining, entry.failures >= t.limit
+}
+
+func (t *IPTracker) RecordFailure(ip string) {
+	if t.limit <= 0 || ip == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	entry, exists := t.entries[ip]
+	if !exists || now.Sub(entry.windowStart) >= t.window {
+		entry = &ipEntry{windowStart: now}
+		t.entries[ip] = entry
+	}
+	entry.failures++
+}
+
+// Drop entries whose window has passed
+func (t *IPTracker) Sweep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for ip, entry := range t.entries {
+		if now.Sub(entry.windowStart) >= t.window {
+			delete(t.entries, ip)
+		}
+	}
+}
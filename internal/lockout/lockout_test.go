@@ -0,0 +1,74 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+)
+
+func TestLockDuration(t *testing.T) {
+	p := Policy{
+		Threshold:    3,
+		BaseDuration: 30 * time.Second,
+		MaxDuration:  5 * time.Minute,
+	}
+
+	for _, tc := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, 30 * time.Second},
+		{4, time.Minute},
+		{5, 2 * time.Minute},
+		{6, 4 * time.Minute},
+		{7, 5 * time.Minute},
+		{8, 5 * time.Minute},
+		{1000, 5 * time.Minute},
+	} {
+		if got := p.LockDuration(tc.failures); got != tc.want {
+			t.Errorf("LockDuration(%d) = %v, want %v", tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestLockDurationDisabled(t *testing.T) {
+	p := DefaultPolicy()
+	p.Threshold = 0
+	if got := p.LockDuration(100); got != 0 {
+		t.Errorf("LockDuration with no threshold = %v, want 0", got)
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	p := Policy{
+		Threshold:    2,
+		BaseDuration: time.Minute,
+		MaxDuration:  time.Hour,
+		ResetAfter:   time.Hour,
+	}
+	user := &model.User{}
+
+	p.RecordFailure(user)
+	if user.FailedLoginAttempts != 1 || user.IsLocked() {
+		t.Fatalf("after 1 failure: attempts = %d, locked = %v", user.FailedLoginAttempts, user.IsLocked())
+	}
+
+	p.RecordFailure(user)
+	if user.FailedLoginAttempts != 2 || !user.IsLocked() {
+		t.Fatalf("after 2 failures: attempts = %d, locked = %v", user.FailedLoginAttempts, user.IsLocked())
+	}
+	if d := time.Until(user.LockedUntil); d <= 0 || d > time.Minute {
+		t.Errorf("locked for %v, want up to %v", d, time.Minute)
+	}
+
+	// Failures older than ResetAfter are forgotten
+	user.LastFailedLogin = time.Now().Add(-2 * time.Hour)
+	user.LockedUntil = time.Time{}
+	p.RecordFailure(user)
+	if user.FailedLoginAttempts != 1 || user.IsLocked() {
+		t.Errorf("after a stale failure: attempts = %d, locked = %v", user.FailedLoginAttempts, user.IsLocked())
+	}
+}
@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Mailer writing messages to a file or stdout instead of sending them, for
+// local development and tests
+type OutboxMailer struct {
+	From string
+	w    io.Writer
+	mu   sync.Mutex
+}
+
+// Messages are appended to the file at path, or written to stdout when path
+// is empty or "-"
+func NewOutboxMailer(path, from string) (*OutboxMailer, error) {
+	var w io.Writer = os.Stdout
+	if path != "" && path != "-" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &OutboxMailer{From: from, w: w}, nil
+}
+
+func (m *OutboxMailer) Send(msg *Message) error {
+	data, err := msg.Bytes(m.From)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := fmt.Fprintf(m.w, "----- outbox: message to %s -----\r\n", msg.To); err != nil {
+		return err
+	}
+	if _, err := m.w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(m.w, "\r\n----- end of message -----\r\n")
+	return err
+}
@@ -0,0 +1,50 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// Subjects of the emails in templates/
+var subjects = map[string]string{
+	"password_reset": "Reset your password",
+	"verify_email":   "Verify your email address",
+	"account_exists": "You already have an account",
+	"no_account":     "Password reset requested",
+	"email_changed":  "Your email address was changed",
+	"email_in_use":   "Your email address was entered for another account",
+}
+
+// Render the email called name (templates/<name>.txt and .html) for to
+func Render(name, to string, data any) (*Message, error) {
+	subject, ok := subjects[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return nil, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      to,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
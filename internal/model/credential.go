@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// WebAuthn (passkey) credential registered by a user
+type Credential struct {
+	ID              []byte // credential ID chosen by the authenticator
+	UserID          string
+	Name            string
+	PublicKey       []byte // COSE-encoded public key
+	AttestationType string
+	Transports      []string
+	AAGUID          []byte
+	SignCount       uint32
+	Flags           uint8 // raw authenticator data flags from the latest ceremony
+	CreatedAt       time.Time
+	LastUsedAt      time.Time
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/token"
+)
+
+// Refresh token issued alongside an access token. Every refresh rotates the
+// token; all tokens descending from the same login share a FamilyID.
+type RefreshToken struct {
+	TokenHash string // SHA-256 of the token, never the token itself
+	FamilyID  string
+	UserID    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    time.Time
+	Revoked   bool
+}
+
+// method to create new RefreshToken instance. An empty familyID starts a new family.
+// Returns the record to store and the token to hand to the client.
+func NewRefreshToken(userID, familyID string, ttl time.Duration) (*RefreshToken, string) {
+	if familyID == "" {
+		familyID = token.New(16)
+	}
+	refreshToken := token.New(token.DefaultBytes)
+	now := time.Now()
+	return &RefreshToken{
+		TokenHash: token.Hash(refreshToken),
+		FamilyID:  familyID,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, refreshToken
+}
+
+// Whether the token was already exchanged
+func (t *RefreshToken) IsUsed() bool {
+	return !t.UsedAt.IsZero()
+}
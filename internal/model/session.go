@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/token"
+)
+
+// Login session. Access and refresh tokens issued for the session carry its ID.
+type Session struct {
+	ID        string
+	UserID    string
+	Device    string
+	IPAddress string
+	CreatedAt time.Time
+	LastSeen  time.Time
+	ExpiresAt time.Time
+}
+
+// method to create new Session instance
+func NewSession(userID, device, ipAddress string, ttl time.Duration) *Session {
+	now := time.Now()
+	return &Session{
+		ID:        token.New(16),
+		UserID:    userID,
+		Device:    device,
+		IPAddress: ipAddress,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+// Whether the session has passed its absolute expiry time, or has been
+// inactive for longer than idleTimeout (not checked when zero)
+func (s *Session) IsExpired(idleTimeout time.Duration) bool {
+	now := time.Now()
+	if now.After(s.ExpiresAt) {
+		return true
+	}
+	return idleTimeout > 0 && now.After(s.LastSeen.Add(idleTimeout))
+}
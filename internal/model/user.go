@@ -1,9 +1,13 @@
 package model
 
 import (
+	"slices"
+	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/automatedtomato/grpc-auth-service/internal/hashing"
+	"github.com/automatedtomato/grpc-auth-service/internal/token"
+	"github.com/automatedtomato/grpc-auth-service/internal/totp"
 )
 
 type User struct {
@@ -12,55 +16,229 @@ type User struct {
 	Email             string
 	PasswordHash      string
 	CreatedAt         time.Time
-	ResetToken        string
+	ResetTokenHash    string // SHA-256 of the reset token, never the token itself
 	ResetTokenExpires time.Time
+	PasswordChangedAt time.Time // zero until the user first changes or resets the password
+
+	// Access control: role names, plus permissions granted outside any role
+	Roles       []string
+	Permissions []string
+
+	// Set while an administrator has disabled the account
+	DisabledAt time.Time
+	// Set when the user deleted the account; it is purged after a delay
+	DeletedAt time.Time
+
+	// Email verification. Only the hash of the emailed token is kept.
+	EmailVerified      bool
+	VerifyTokenHash    string
+	VerifyTokenExpires time.Time
+
+	// Brute-force protection state
+	FailedLoginAttempts int
+	LastFailedLogin     time.Time
+	LockedUntil         time.Time
+
+	// TOTP second factor. The secret is set on enrollment and only used for
+	// logins once TOTPEnabled is set by a confirmed code.
+	TOTPSecret      string
+	TOTPEnabled     bool
+	TOTPLastCounter int64 // time step of the last accepted code, to prevent replay
+
+	// SHA-256 hashes of unused single-use MFA recovery codes
+	RecoveryCodeHashes []string
 }
 
 // method to create new User instance
-func NewUser(username, email, password string) (*User, error) {
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+func NewUser(username, email, password string, hasher hashing.Hasher) (*User, error) {
+	user := &User{
+		ID:        token.NewUUIDv7(),
+		Username:  username,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+	if err := user.SetPassword(password, hasher); err != nil {
 		return nil, err
 	}
-
-	return &User{
-		ID:           generateID(),
-		Username:     username,
-		Email:        email,
-		PasswordHash: string(hashedPassword),
-		CreatedAt:    time.Now(),
-	}, nil
+	return user, nil
 }
 
-func generateID() string {
-	return time.Now().Format("20060102150405") + RandomString(6)
+// Hash and set a new password
+func (u *User) SetPassword(password string, hasher hashing.Hasher) error {
+	hashedPassword, err := hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = hashedPassword
+	return nil
 }
 
-func RandomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
-		time.Sleep(1 * time.Nanosecond)
+// Set a new password chosen by the user and record when it changed
+func (u *User) ChangePassword(password string, hasher hashing.Hasher) error {
+	if err := u.SetPassword(password, hasher); err != nil {
+		return err
 	}
-	return string(b)
+	u.PasswordChangedAt = time.Now()
+	return nil
 }
 
 // Validate password
 func (u *User) CheckPassword(password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
-	return err == nil
+	ok, err := hashing.Verify(password, u.PasswordHash)
+	return err == nil && ok
 }
 
+// How long a password reset token stays valid
+const ResetTokenTTL = 24 * time.Hour
+
+// Generate a reset token, keeping only its hash. Returns the token to hand to the user.
 func (u *User) SetResetToken() string {
-	token := generateToken()
-	u.ResetToken = token
-	u.ResetTokenExpires = time.Now().Add(24 * time.Hour) // Valid for 24 hours
-	return token
+	resetToken := token.New(token.DefaultBytes)
+	u.ResetTokenHash = token.Hash(resetToken)
+	u.ResetTokenExpires = time.Now().Add(ResetTokenTTL)
+	return resetToken
+}
+
+func (u *User) ClearResetToken() {
+	u.ResetTokenHash = ""
+	u.ResetTokenExpires = time.Time{}
 }
 
-// Utility function: TODO Implement later
-func generateToken() string {
-	return time.Now().Format("20060102150405") + RandomString(6)
+// How long an email verification token stays valid
+const VerifyTokenTTL = 48 * time.Hour
+
+// Generate an email verification token, keeping only its hash. Returns the
+// token to send to the user's address.
+func (u *User) SetVerifyToken() string {
+	verifyToken := token.New(token.DefaultBytes)
+	u.VerifyTokenHash = token.Hash(verifyToken)
+	u.VerifyTokenExpires = time.Now().Add(VerifyTokenTTL)
+	return verifyToken
+}
+
+// Mark the email address as verified and drop the outstanding token
+func (u *User) MarkEmailVerified() {
+	u.EmailVerified = true
+	u.VerifyTokenHash = ""
+	u.VerifyTokenExpires = time.Time{}
+}
+
+func (u *User) HasRole(role string) bool {
+	return slices.Contains(u.Roles, role)
+}
+
+// Add role unless the user already has it. Reports whether it was added.
+func (u *User) AddRole(role string) bool {
+	if u.HasRole(role) {
+		return false
+	}
+	u.Roles = append(u.Roles, role)
+	return true
+}
+
+func (u *User) IsDisabled() bool {
+	return !u.DisabledAt.IsZero()
+}
+
+func (u *User) IsDeleted() bool {
+	return !u.DeletedAt.IsZero()
+}
+
+// Mark the account deleted, dropping outstanding reset and verification tokens
+func (u *User) MarkDeleted() {
+	u.DeletedAt = time.Now()
+	u.ClearResetToken()
+	u.VerifyTokenHash = ""
+	u.VerifyTokenExpires = time.Time{}
+}
+
+// Switch to a new, unverified email address. Returns the verification
+// token to send to it.
+func (u *User) ChangeEmail(email string) string {
+	u.Email = email
+	u.EmailVerified = false
+	return u.SetVerifyToken()
+}
+
+// Make the password unusable and issue a reset token, so the user has to
+// choose a new password. Returns the reset token.
+func (u *User) ForcePasswordReset() string {
+	u.PasswordHash = ""
+	return u.SetResetToken()
+}
+
+// Whether the account is locked after too many failed logins
+func (u *User) IsLocked() bool {
+	return time.Now().Before(u.LockedUntil)
+}
+
+// Forget failed logins and lift any lock
+func (u *User) ClearLockout() {
+	u.FailedLoginAttempts = 0
+	u.LastFailedLogin = time.Time{}
+	u.LockedUntil = time.Time{}
+}
+
+// Start TOTP enrollment with a fresh secret, returned for the authenticator app
+func (u *User) EnrollTOTP() string {
+	u.TOTPSecret = totp.GenerateSecret()
+	u.TOTPEnabled = false
+	u.TOTPLastCounter = 0
+	return u.TOTPSecret
+}
+
+// Check a TOTP code, allowing one time step of clock drift. A code is
+// accepted only once.
+func (u *User) VerifyTOTP(code string) bool {
+	if u.TOTPSecret == "" {
+		return false
+	}
+	counter, ok := totp.Validate(u.TOTPSecret, code, time.Now(), 1)
+	if !ok || counter <= u.TOTPLastCounter {
+		return false
+	}
+	u.TOTPLastCounter = counter
+	return true
+}
+
+func (u *User) DisableTOTP() {
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPLastCounter = 0
+	u.RecoveryCodeHashes = nil
+}
+
+// Number of recovery codes issued at a time
+const RecoveryCodeCount = 10
+
+// Replace any existing recovery codes with new ones, keeping only their
+// hashes. Returns the codes to show the user once.
+func (u *User) GenerateRecoveryCodes() []string {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		// 16 characters, 80 bits, grouped for readability
+		raw := token.NewCode(16)
+		codes[i] = raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+		hashes[i] = token.Hash(raw)
+	}
+	u.RecoveryCodeHashes = hashes
+	return codes
+}
+
+// Consume a recovery code. Case, spaces and dashes are ignored.
+func (u *User) UseRecoveryCode(code string) bool {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if normalized == "" {
+		return false
+	}
+
+	hash := token.Hash(normalized)
+	for i, stored := range u.RecoveryCodeHashes {
+		if token.Equal(stored, hash) {
+			u.RecoveryCodeHashes = append(u.RecoveryCodeHashes[:i:i], u.RecoveryCodeHashes[i+1:]...)
+			return true
+		}
+	}
+	return false
 }
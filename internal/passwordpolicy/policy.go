@@ -0,0 +1,161 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation codes
+const (
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeCharClasses  = "insufficient_character_classes"
+	CodeContainsUser = "contains_user_info"
+	CodeCommon       = "common_password"
+)
+
+// bcrypt only looks at the first 72 bytes of a password
+const BcryptMaxBytes = 72
+
+// Rule the password failed
+type Violation struct {
+	Code        string
+	Description string
+}
+
+type Policy struct {
+	// Length limits in characters
+	MinLength int
+	MaxLength int
+	// Length limit in bytes, 0 for none. Set to BcryptMaxBytes when hashing
+	// with bcrypt, which would otherwise reject or truncate longer passwords.
+	MaxBytes int
+	// Number of distinct character classes (lower, upper, digit, symbol) required
+	MinCharClasses int
+	// Reject passwords containing the username or email local part
+	RejectUserInfo bool
+
+	common map[string]struct{}
+}
+
+func NewPolicy() *Policy {
+	return &Policy{
+		MinLength:      8,
+		MaxLength:      128,
+		MinCharClasses: 2,
+		RejectUserInfo: true,
+		common:         make(map[string]struct{}),
+	}
+}
+
+// Load a list of breached or common passwords, one per line. Lines starting
+// with # are comments. Matching is case-insensitive.
+func (p *Policy) LoadCommonPasswords(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.common[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Check password against the policy, returning every rule it fails
+func (p *Policy) Check(password, username, email string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{
+			Code:        CodeTooShort,
+			Description: fmt.Sprintf("Password must be at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{
+			Code:        CodeTooLong,
+			Description: fmt.Sprintf("Password must be at most %d characters", p.MaxLength),
+		})
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, Violation{
+			Code:        CodeTooLong,
+			Description: fmt.Sprintf("Password must be at most %d bytes", p.MaxBytes),
+		})
+	}
+
+	if classes := charClasses(password); classes < p.MinCharClasses {
+		violations = append(violations, Violation{
+			Code: CodeCharClasses,
+			Description: fmt.Sprintf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols",
+				p.MinCharClasses),
+		})
+	}
+
+	if p.RejectUserInfo && containsUserInfo(password, username, email) {
+		violations = append(violations, Violation{
+			Code:        CodeContainsUser,
+			Description: "Password must not contain your username or email address",
+		})
+	}
+
+	if _, found := p.common[strings.ToLower(password)]; found {
+		violations = append(violations, Violation{
+			Code:        CodeCommon,
+			Description: "Password is too common or has appeared in a data breach",
+		})
+	}
+
+	return violations
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// Short fragments would reject too many legitimate passwords
+const minUserInfoLength = 3
+
+func containsUserInfo(password, username, email string) bool {
+	lowered := strings.ToLower(password)
+
+	localPart, _, _ := strings.Cut(email, "@")
+	for _, info := range []string{username, localPart} {
+		info = strings.ToLower(info)
+		if len(info) >= minUserInfoLength && strings.Contains(lowered, info) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package passwordpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func codes(violations []Violation) []string {
+	var out []string
+	for _, v := range violations {
+		out = append(out, v.Code)
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		password string
+		username string
+		email    string
+		want     []string
+	}{
+		{"good", "correct-Horse7", "alice", "alice@example.com", nil},
+		{"too short", "aB3$", "alice", "alice@example.com", []string{CodeTooShort}},
+		{"too long", strings.Repeat("aB3$", 33), "alice", "alice@example.com", []string{CodeTooLong}},
+		{"one class", "alllowercase", "bob", "bob@example.com", []string{CodeCharClasses}},
+		{"short and one class", "abc", "bob", "bob@example.com", []string{CodeTooShort, CodeCharClasses}},
+		{"contains username", "xAlice2024x", "alice", "a@example.com", []string{CodeContainsUser}},
+		{"contains email local part", "Wonderland-9", "bob", "wonderland@example.com", []string{CodeContainsUser}},
+		{"short user info ignored", "Jo-passw0rd", "jo", "jo@example.com", nil},
+		{"characters, not bytes", "パスワードです1", "alice", "alice@example.com", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := codes(NewPolicy().Check(tc.password, tc.username, tc.email))
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("violations = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckMaxBytes(t *testing.T) {
+	p := NewPolicy()
+	p.MaxBytes = BcryptMaxBytes
+
+	// 25 three-byte characters are within MaxLength but over 72 bytes
+	long := strings.Repeat("パ", 25) + "1"
+	if got := codes(p.Check(long, "alice", "alice@example.com")); !slices.Equal(got, []string{CodeTooLong}) {
+		t.Errorf("violations = %v, want [%s]", got, CodeTooLong)
+	}
+	if got := p.Check(long[:BcryptMaxBytes-1]+"1", "alice", "alice@example.com"); len(got) != 0 {
+		t.Errorf("violations = %v for a password within the byte limit", codes(got))
+	}
+}
+
+func TestCommonPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "common.txt")
+	list := "# most common first\nPassword1\n\n  letmein99  \n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPolicy()
+	if err := p.LoadCommonPasswords(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		password string
+		common   bool
+	}{
+		{"Password1", true},
+		{"PASSWORD1", true},
+		{"letmein99", true},
+		{"# most common first", false},
+		{"Password12", false},
+	} {
+		got := slices.Contains(codes(p.Check(tc.password, "alice", "alice@example.com")), CodeCommon)
+		if got != tc.common {
+			t.Errorf("%q: common = %v, want %v", tc.password, got, tc.common)
+		}
+	}
+}
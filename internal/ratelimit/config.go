@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Limits applied to one RPC. Each key kind has its own bucket; a nil rule
+// leaves that kind unlimited.
+type Limits struct {
+	// Per client IP
+	IP *Rule `json:"ip,omitempty"`
+	// Shared by all callers of the method
+	Method *Rule `json:"method,omitempty"`
+	// Per authenticated user, for RPCs that carry a session token
+	User *Rule `json:"user,omitempty"`
+}
+
+// Rate limit configuration, keyed by full gRPC method name
+// (e.g. "/auth.AuthService/Register")
+type Config struct {
+	// Limits for methods without an entry in Methods
+	Default Limits            `json:"default"`
+	Methods map[string]Limits `json:"methods"`
+}
+
+// Limits used when no configuration file is given. The unauthenticated RPCs
+// that do expensive work or send mail get the tightest limits.
+func DefaultConfig() *Config {
+	return &Config{
+		Default: Limits{
+			IP:   &Rule{Rate: 10, Burst: 50},
+			User: &Rule{Rate: 5, Burst: 20},
+		},
+		Methods: map[string]Limits{
+			"/auth.AuthService/Register": {
+				IP:     &Rule{Rate: 0.05, Burst: 5},
+				Method: &Rule{Rate: 20, Burst: 100},
+			},
+			"/auth.AuthService/Login": {
+				IP: &Rule{Rate: 1, Burst: 10},
+			},
+			"/auth.AuthService/RequestPasswordReset": {
+				IP:     &Rule{Rate: 0.05, Burst: 3},
+				Method: &Rule{Rate: 10, Burst: 50},
+			},
+			"/auth.AuthService/ResendVerification": {
+				IP:     &Rule{Rate: 0.05, Burst: 3},
+				Method: &Rule{Rate: 10, Burst: 50},
+			},
+			// Called by client services on behalf of many users
+			"/auth.AuthService/Introspect": {
+				IP: &Rule{Rate: 100, Burst: 500},
+			},
+		},
+	}
+}
+
+// Read a JSON configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Limits that apply to method
+func (c *Config) For(method string) Limits {
+	if limits, ok := c.Methods[method]; ok {
+		return limits
+	}
+	return c.Default
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Token bucket parameters: Rate tokens are added per second, up to Burst
+type Rule struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Limiter backend. Implementations may keep buckets in process or in a
+// shared store so limits hold across server instances.
+type Limiter interface {
+	// Take one token from the bucket identified by key. When the bucket is
+	// empty, report how long until a token becomes available.
+	Allow(key string, rule Rule) (retryAfter time.Duration, ok bool)
+}
+
+// Limiter keeping buckets in process memory
+type MemoryLimiter struct {
+	buckets map[string]*bucket
+	mu      sync.Mutex
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	rule    Rule
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *MemoryLimiter) Allow(key string, rule Rule) (time.Duration, bool) {
+	if rule.Rate <= 0 || rule.Burst <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(rule.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.rule = rule
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait := (1 - b.tokens) / rule.Rate
+	return time.Duration(math.Ceil(wait * float64(time.Second))), false
+}
+
+// Drop buckets that have refilled completely; they behave like new ones
+func (l *MemoryLimiter) Sweep() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.rule.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(float64(b.rule.Burst), b.tokens+elapsed*b.rule.Rate)
+	b.updated = now
+}
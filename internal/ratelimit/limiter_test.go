@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// Pretend d has passed since the bucket for key was last used
+func (l *MemoryLimiter) rewind(key string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buckets[key].updated = l.buckets[key].updated.Add(-d)
+}
+
+func TestAllowBurst(t *testing.T) {
+	l := NewMemoryLimiter()
+	rule := Rule{Rate: 1, Burst: 3}
+
+	for i := range rule.Burst {
+		if _, ok := l.Allow("k", rule); !ok {
+			t.Fatalf("request %d within the burst refused", i+1)
+		}
+	}
+	retryAfter, ok := l.Allow("k", rule)
+	if ok {
+		t.Fatal("request past the burst allowed")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("retry after %v, want up to 1s", retryAfter)
+	}
+
+	// Buckets are independent
+	if _, ok := l.Allow("other", rule); !ok {
+		t.Error("request on another key refused")
+	}
+}
+
+func TestAllowRefill(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		elapsed time.Duration
+		allowed int
+	}{
+		{"no time", 0, 0},
+		{"half a token", 250 * time.Millisecond, 0},
+		{"one token", 500 * time.Millisecond, 1},
+		{"three tokens", 1500 * time.Millisecond, 3},
+		{"capped at burst", time.Hour, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewMemoryLimiter()
+			rule := Rule{Rate: 2, Burst: 4}
+			for range rule.Burst {
+				l.Allow("k", rule)
+			}
+
+			l.rewind("k", tc.elapsed)
+			allowed := 0
+			for {
+				if _, ok := l.Allow("k", rule); !ok {
+					break
+				}
+				allowed++
+			}
+			if allowed != tc.allowed {
+				t.Errorf("allowed %d requests, want %d", allowed, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestAllowUnlimited(t *testing.T) {
+	l := NewMemoryLimiter()
+	for _, rule := range []Rule{{Rate: 0, Burst: 1}, {Rate: 1, Burst: 0}} {
+		for range 10 {
+			if _, ok := l.Allow("k", rule); !ok {
+				t.Fatalf("rule %+v limited a request", rule)
+			}
+		}
+	}
+}
+
+func TestSweepDropsFullBuckets(t *testing.T) {
+	l := NewMemoryLimiter()
+	rule := Rule{Rate: 1, Burst: 2}
+	l.Allow("full", rule)
+	l.Allow("drained", rule)
+	l.Allow("drained", rule)
+
+	l.rewind("full", time.Second)
+	l.Sweep()
+
+	if _, exists := l.buckets["full"]; exists {
+		t.Error("refilled bucket kept")
+	}
+	if _, exists := l.buckets["drained"]; !exists {
+		t.Error("drained bucket dropped")
+	}
+}
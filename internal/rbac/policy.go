@@ -0,0 +1,111 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Permission granted by a role that allows everything
+const Wildcard = "*"
+
+// Role with every permission in the default policy
+const AdminRole = "admin"
+
+// Role-based access policy. Permissions are plain strings such as
+// "account:read"; roles are named sets of them.
+type Policy struct {
+	// Permissions of each role
+	Roles map[string][]string `json:"roles"`
+	// Permission required to call each RPC, keyed by full gRPC method name
+	// (e.g. "/auth.AuthService/GetUserInfo"). Methods without an entry need
+	// no permission.
+	Methods map[string]string `json:"methods"`
+	// Roles given to newly registered users
+	DefaultRoles []string `json:"default_roles"`
+}
+
+// Policy used when no policy file is given. Regular users manage their own
+// account; admins may do anything.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Roles: map[string][]string{
+			"user":    {"account:read", "account:write"},
+			AdminRole: {Wildcard},
+		},
+		Methods: map[string]string{
+			"/auth.AuthService/GetUserInfo":               "account:read",
+			"/auth.AuthService/ListSessions":              "account:read",
+			"/auth.AuthService/ChangePassword":            "account:write",
+			"/auth.AuthService/UpdateProfile":             "account:write",
+			"/auth.AuthService/DeleteAccount":             "account:write",
+			"/auth.AuthService/EnrollTOTP":                "account:write",
+			"/auth.AuthService/ConfirmTOTP":               "account:write",
+			"/auth.AuthService/DisableTOTP":               "account:write",
+			"/auth.AuthService/GenerateRecoveryCodes":     "account:write",
+			"/auth.AuthService/BeginPasskeyRegistration":  "account:write",
+			"/auth.AuthService/FinishPasskeyRegistration": "account:write",
+			"/auth.AdminService/ListUsers":                "users:read",
+			"/auth.AdminService/GetUser":                  "users:read",
+			"/auth.AdminService/DisableUser":              "users:write",
+			"/auth.AdminService/EnableUser":               "users:write",
+			"/auth.AdminService/UnlockUser":               "users:write",
+			"/auth.AdminService/RestoreUser":              "users:write",
+			"/auth.AdminService/DeleteUser":               "users:delete",
+			"/auth.AdminService/ForcePasswordReset":       "users:write",
+			"/auth.AdminService/RevokeUserSessions":       "sessions:revoke",
+		},
+		DefaultRoles: []string{"user"},
+	}
+}
+
+// Read a JSON policy file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, role := range p.DefaultRoles {
+		if _, ok := p.Roles[role]; !ok {
+			return nil, fmt.Errorf("%s: default role %q is not defined", path, role)
+		}
+	}
+	for method, permission := range p.Methods {
+		if permission == "" {
+			return nil, fmt.Errorf("%s: empty permission for %s", path, method)
+		}
+	}
+	return &p, nil
+}
+
+// Permission required to call method, empty if none
+func (p *Policy) Required(method string) string {
+	return p.Methods[method]
+}
+
+// Permissions held through roles plus those granted directly, sorted and
+// without duplicates. Unknown roles grant nothing.
+func (p *Policy) Permissions(roles, direct []string) []string {
+	perms := slices.Clone(direct)
+	for _, role := range roles {
+		perms = append(perms, p.Roles[role]...)
+	}
+	slices.Sort(perms)
+	return slices.Compact(perms)
+}
+
+// Whether the roles and directly granted permissions include permission
+func (p *Policy) Allows(roles, direct []string, permission string) bool {
+	for _, perm := range p.Permissions(roles, direct) {
+		if perm == permission || perm == Wildcard {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package rbac
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAllows(t *testing.T) {
+	p := &Policy{
+		Roles: map[string][]string{
+			"user":    {"account:read", "account:write"},
+			"support": {"users:read"},
+			AdminRole: {Wildcard},
+		},
+	}
+
+	for _, tc := range []struct {
+		name       string
+		roles      []string
+		direct     []string
+		permission string
+		want       bool
+	}{
+		{"role grants", []string{"user"}, nil, "account:read", true},
+		{"role lacks", []string{"user"}, nil, "users:read", false},
+		{"any of several roles", []string{"user", "support"}, nil, "users:read", true},
+		{"wildcard", []string{AdminRole}, nil, "users:delete", true},
+		{"direct grant", []string{"user"}, []string{"sessions:revoke"}, "sessions:revoke", true},
+		{"direct wildcard", nil, []string{Wildcard}, "users:write", true},
+		{"unknown role", []string{"superuser"}, nil, "account:read", false},
+		{"no roles", nil, nil, "account:read", false},
+		{"no prefix matching", []string{"user"}, nil, "account", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := p.Allows(tc.roles, tc.direct, tc.permission); got != tc.want {
+				t.Errorf("Allows(%v, %v, %q) = %v, want %v", tc.roles, tc.direct, tc.permission, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	p := DefaultPolicy()
+	got := p.Permissions([]string{"user", "user"}, []string{"users:read", "account:read"})
+	want := []string{"account:read", "account:write", "users:read"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Permissions = %v, want %v", got, want)
+	}
+}
+
+// The default policy lists every admin RPC and reserves it for admins
+func TestDefaultPolicyCoversAdminService(t *testing.T) {
+	p := DefaultPolicy()
+	for _, method := range []string{
+		"/auth.AdminService/ListUsers",
+		"/auth.AdminService/GetUser",
+		"/auth.AdminService/DisableUser",
+		"/auth.AdminService/EnableUser",
+		"/auth.AdminService/UnlockUser",
+		"/auth.AdminService/RestoreUser",
+		"/auth.AdminService/DeleteUser",
+		"/auth.AdminService/ForcePasswordReset",
+		"/auth.AdminService/RevokeUserSessions",
+	} {
+		required := p.Required(method)
+		if required == "" {
+			t.Errorf("%s requires no permission", method)
+			continue
+		}
+		if p.Allows([]string{"user"}, nil, required) {
+			t.Errorf("user role may call %s", method)
+		}
+		if !p.Allows([]string{AdminRole}, nil, required) {
+			t.Errorf("admin role may not call %s", method)
+		}
+	}
+}
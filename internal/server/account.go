@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"google.golang.org/grpc/codes"
+)
+
+// Change the current user's username and/or email. Uniqueness is left to
+// the user store, which rejects names and addresses used by other accounts.
+func (s *AuthServer) UpdateProfile(ctx context.Context, req *proto.UpdateProfileRequest) (*proto.UpdateProfileResponse, error) {
+	if s.hideAccounts {
+		defer s.padResponse(ctx, time.Now())
+	}
+
+	if req.Username == "" && req.Email == "" {
+		return nil, invalidArgument(reasonMissingField, "Username or email is required",
+			fieldViolation("username", reasonMissingField, "username or email is required"),
+			fieldViolation("email", reasonMissingField, "username or email is required"))
+	}
+	if req.Email != "" && !validEmail(req.Email) {
+		return nil, invalidEmail()
+	}
+	if req.Password == "" {
+		return nil, invalidArgument(reasonMissingField, "Password is required",
+			fieldViolation("password", reasonMissingField, "password is required"))
+	}
+
+	user, _, err := s.authenticatedUser(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.confirmPassword(ctx, user, "password", req.Password); err != nil {
+		return nil, err
+	}
+
+	oldUsername, oldEmail := user.Username, user.Email
+	if req.Username != "" {
+		user.Username = req.Username
+	}
+	var verifyToken string
+	if req.Email != "" && req.Email != oldEmail {
+		verifyToken = user.ChangeEmail(req.Email)
+	}
+
+	if user.Username != oldUsername || verifyToken != "" {
+		if err := s.userStore.Update(user); err != nil {
+			switch {
+			case errors.Is(err, storage.ErrDuplicateUsername):
+				return nil, statusError(codes.AlreadyExists, reasonUsernameTaken, "Username already exists")
+			case errors.Is(err, storage.ErrDuplicateEmail):
+				if s.hideAccounts {
+					return s.updateProfileExistingEmail(user.ID, req)
+				}
+				return nil, statusError(codes.AlreadyExists, reasonEmailTaken, "Email already exists")
+			}
+			return nil, internalError("Failed to update profile", err)
+		}
+	}
+
+	// The change is saved at this point; a lost verification email can be
+	// sent again with ResendVerification
+	if verifyToken != "" {
+		if err := s.sendAccountEmail("verification", func() error {
+			return s.sendVerification(user, verifyToken)
+		}); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+		}
+		if err := s.sendAccountEmail("email changed", func() error {
+			return s.sendEmailChanged(user, oldEmail)
+		}); err != nil {
+			log.Printf("Failed to send email change notice to user %s: %v", user.ID, err)
+		}
+	}
+
+	return profileUpdated(user.Username, user.Email, user.EmailVerified), nil
+}
+
+// Answer a change to an email address that already has an account as if
+// the address were free, like registerExistingEmail; the address's owner is
+// told by email instead. A username change in the same request still applies.
+func (s *AuthServer) updateProfileExistingEmail(id string, req *proto.UpdateProfileRequest) (*proto.UpdateProfileResponse, error) {
+	// Start over from the stored user; the rejected copy carries the new email
+	user, err := s.userStore.GetByID(id)
+	if err != nil {
+		return nil, internalError("Failed to update profile", err)
+	}
+	if req.Username != "" && req.Username != user.Username {
+		user.Username = req.Username
+		if err := s.userStore.Update(user); err != nil {
+			// Usernames are public, so a taken one is still reported
+			if errors.Is(err, storage.ErrDuplicateUsername) {
+				return nil, statusError(codes.AlreadyExists, reasonUsernameTaken, "Username already exists")
+			}
+			return nil, internalError("Failed to update profile", err)
+		}
+	}
+
+	existing, err := s.userStore.GetByEmail(req.Email)
+	if err != nil {
+		log.Printf("Failed to look up owner of email taken by user %s: %v", user.ID, err)
+	} else if err := s.sendAccountEmail("email in use", func() error {
+		return s.sendEmailInUse(existing)
+	}); err != nil {
+		log.Printf("Failed to send email in use notice to user %s: %v", existing.ID, err)
+	}
+
+	// Looks like a change to a new, unverified address
+	return profileUpdated(user.Username, req.Email, false), nil
+}
+
+func profileUpdated(username, email string, emailVerified bool) *proto.UpdateProfileResponse {
+	return &proto.UpdateProfileResponse{
+		Success:       true,
+		Message:       "Profile updated successfully",
+		Username:      username,
+		Email:         email,
+		EmailVerified: emailVerified,
+	}
+}
+
+// Delete the current user's account. It stays in the store, unusable,
+// until purgeDeletedAccounts removes it after the purge delay.
+func (s *AuthServer) DeleteAccount(ctx context.Context, req *proto.DeleteAccountRequest) (*proto.DeleteAccountResponse, error) {
+	if req.Password == "" {
+		return nil, invalidArgument(reasonMissingField, "Password is required",
+			fieldViolation("password", reasonMissingField, "password is required"))
+	}
+
+	user, _, err := s.authenticatedUser(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.confirmPassword(ctx, user, "password", req.Password); err != nil {
+		return nil, err
+	}
+
+	user.MarkDeleted()
+	if err := s.userStore.Update(user); err != nil {
+		return nil, internalError("Failed to delete account", err)
+	}
+	if _, err := s.endAllSessions(user.ID); err != nil {
+		return nil, internalError("Failed to end sessions", err)
+	}
+	log.Printf("User %s deleted their account", user.ID)
+
+	return &proto.DeleteAccountResponse{
+		Success: true,
+		Message: "Account deleted successfully",
+		PurgeAt: user.DeletedAt.Add(s.purgeDelay).Unix(),
+	}, nil
+}
+
+// Remove accounts whose purge delay has passed
+func (s *AuthServer) purgeDeletedAccounts() {
+	users, err := s.userStore.List(storage.UserFilter{
+		DeletedBefore: time.Now().Add(-s.purgeDelay),
+	})
+	if err != nil {
+		log.Printf("Failed to list deleted accounts: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		if _, err := s.credentials.DeleteByUser(user.ID); err != nil {
+			log.Printf("Failed to delete passkeys of user %s: %v", user.ID, err)
+			continue
+		}
+		if err := s.userStore.Delete(user.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to purge user %s: %v", user.ID, err)
+			continue
+		}
+		log.Printf("Purged deleted user %s", user.ID)
+	}
+}
+
+// Treat accounts awaiting purge as gone when looking users up by username
+// or email
+func activeUser(user *model.User, err error) (*model.User, error) {
+	if err == nil && user.IsDeleted() {
+		return nil, storage.ErrNotFound
+	}
+	return user, err
+}
+
+func accountDeletedError() error {
+	return statusError(codes.PermissionDenied, reasonAccountDeleted, "Account has been deleted")
+}
@@ -0,0 +1,317 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"google.golang.org/grpc/codes"
+)
+
+// Page sizes of ListUsers
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// Full method name prefix of the admin RPCs
+var adminServicePrefix = "/" + proto.AdminService_ServiceDesc.ServiceName + "/"
+
+// Implementation of the gRPC admin service. Callers are authorized by the
+// access policy interceptor before a handler runs.
+type AdminServer struct {
+	proto.UnimplementedAdminServiceServer
+	auth *AuthServer
+}
+
+func NewAdminServer(auth *AuthServer) *AdminServer {
+	return &AdminServer{auth: auth}
+}
+
+func (a *AdminServer) ListUsers(ctx context.Context, req *proto.ListUsersRequest) (*proto.ListUsersResponse, error) {
+	pageSize := int(req.PageSize)
+	switch {
+	case pageSize <= 0:
+		pageSize = defaultUserPageSize
+	case pageSize > maxUserPageSize:
+		pageSize = maxUserPageSize
+	}
+
+	filter := storage.UserFilter{
+		Query:   req.Query,
+		Role:    req.Role,
+		AfterID: req.PageToken,
+		Limit:   pageSize + 1, // one more to tell whether another page follows
+	}
+	switch req.Status {
+	case proto.UserStatus_USER_STATUS_ACTIVE:
+		disabled := false
+		filter.Disabled = &disabled
+	case proto.UserStatus_USER_STATUS_DISABLED:
+		disabled := true
+		filter.Disabled = &disabled
+	}
+
+	users, err := a.auth.userStore.List(filter)
+	if err != nil {
+		return nil, internalError("Failed to list users", err)
+	}
+
+	resp := &proto.ListUsersResponse{
+		Success: true,
+		Message: "Users listed successfully",
+	}
+	if len(users) > pageSize {
+		users = users[:pageSize]
+		resp.NextPageToken = users[pageSize-1].ID
+	}
+	for _, user := range users {
+		resp.Users = append(resp.Users, userRecord(user))
+	}
+	return resp, nil
+}
+
+func (a *AdminServer) GetUser(ctx context.Context, req *proto.GetUserRequest) (*proto.GetUserResponse, error) {
+	user, err := a.lookupUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.GetUserResponse{
+		Success: true,
+		Message: "User received successfully",
+		User:    userRecord(user),
+	}, nil
+}
+
+func (a *AdminServer) DisableUser(ctx context.Context, req *proto.DisableUserRequest) (*proto.DisableUserResponse, error) {
+	user, err := a.lookupOtherUser(req.SessionToken, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsDisabled() {
+		user.DisabledAt = time.Now()
+		if err := a.auth.userStore.Update(user); err != nil {
+			return nil, internalError("Failed to disable user", err)
+		}
+		log.Printf("Disabled user %s", user.ID)
+	}
+
+	revoked, err := a.auth.endAllSessions(user.ID)
+	if err != nil {
+		return nil, internalError("Failed to end sessions", err)
+	}
+
+	return &proto.DisableUserResponse{
+		Success:         true,
+		Message:         "User disabled successfully",
+		SessionsRevoked: int32(revoked),
+	}, nil
+}
+
+func (a *AdminServer) EnableUser(ctx context.Context, req *proto.EnableUserRequest) (*proto.EnableUserResponse, error) {
+	user, err := a.lookupUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsDisabled() {
+		user.DisabledAt = time.Time{}
+		if err := a.auth.userStore.Update(user); err != nil {
+			return nil, internalError("Failed to enable user", err)
+		}
+		log.Printf("Enabled user %s", user.ID)
+	}
+
+	return &proto.EnableUserResponse{
+		Success: true,
+		Message: "User enabled successfully",
+	}, nil
+}
+
+// Forget failed logins and lift any lock, leaving the account otherwise
+// as it is
+func (a *AdminServer) UnlockUser(ctx context.Context, req *proto.UnlockUserRequest) (*proto.UnlockUserResponse, error) {
+	user, err := a.lookupUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.auth.userStore.ClearLoginFailures(user.ID); err != nil {
+		return nil, internalError("Failed to unlock user", err)
+	}
+	log.Printf("Unlocked user %s", user.ID)
+
+	return &proto.UnlockUserResponse{
+		Success: true,
+		Message: "User unlocked successfully",
+	}, nil
+}
+
+// Undo DeleteAccount before the account is purged. A disabled account
+// stays disabled.
+func (a *AdminServer) RestoreUser(ctx context.Context, req *proto.RestoreUserRequest) (*proto.RestoreUserResponse, error) {
+	user, err := a.lookupUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsDeleted() {
+		user.DeletedAt = time.Time{}
+		if err := a.auth.userStore.Update(user); err != nil {
+			return nil, internalError("Failed to restore user", err)
+		}
+		log.Printf("Restored user %s", user.ID)
+	}
+
+	return &proto.RestoreUserResponse{
+		Success: true,
+		Message: "User restored successfully",
+	}, nil
+}
+
+func (a *AdminServer) DeleteUser(ctx context.Context, req *proto.DeleteUserRequest) (*proto.DeleteUserResponse, error) {
+	user, err := a.lookupOtherUser(req.SessionToken, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := a.auth.endAllSessions(user.ID); err != nil {
+		return nil, internalError("Failed to end sessions", err)
+	}
+	if _, err := a.auth.credentials.DeleteByUser(user.ID); err != nil {
+		return nil, internalError("Failed to delete passkeys", err)
+	}
+	if err := a.auth.userStore.Delete(user.ID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, statusError(codes.NotFound, reasonUserNotFound, "User not found")
+		}
+		return nil, internalError("Failed to delete user", err)
+	}
+	log.Printf("Deleted user %s", user.ID)
+
+	return &proto.DeleteUserResponse{
+		Success: true,
+		Message: "User deleted successfully",
+	}, nil
+}
+
+// Passkeys are revoked along with the password, since one may have been
+// registered by whoever the reset is meant to lock out. The email goes out
+// first: if it cannot be sent, the account is left as it was.
+func (a *AdminServer) ForcePasswordReset(ctx context.Context, req *proto.ForcePasswordResetRequest) (*proto.ForcePasswordResetResponse, error) {
+	user, err := a.lookupUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	resetToken := user.ForcePasswordReset()
+	if err := a.auth.sendPasswordReset(user, resetToken); err != nil {
+		return nil, internalError("Failed to send password reset email", err)
+	}
+	if err := a.auth.userStore.Update(user); err != nil {
+		return nil, internalError("Failed to reset password", err)
+	}
+	log.Printf("Forced password reset of user %s", user.ID)
+
+	passkeys, err := a.auth.credentials.DeleteByUser(user.ID)
+	if err != nil {
+		return nil, internalError("Failed to revoke passkeys", err)
+	}
+	revoked, err := a.auth.endAllSessions(user.ID)
+	if err != nil {
+		return nil, internalError("Failed to end sessions", err)
+	}
+
+	return &proto.ForcePasswordResetResponse{
+		Success:         true,
+		Message:         "Password reset link sent to the user",
+		SessionsRevoked: int32(revoked),
+		PasskeysRevoked: int32(passkeys),
+	}, nil
+}
+
+func (a *AdminServer) RevokeUserSessions(ctx context.Context, req *proto.RevokeUserSessionsRequest) (*proto.RevokeUserSessionsResponse, error) {
+	user, err := a.lookupUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := a.auth.endAllSessions(user.ID)
+	if err != nil {
+		return nil, internalError("Failed to end sessions", err)
+	}
+
+	return &proto.RevokeUserSessionsResponse{
+		Success:         true,
+		Message:         "Sessions revoked successfully",
+		SessionsRevoked: int32(revoked),
+	}, nil
+}
+
+// Load the user an admin request is about. Failures are returned as gRPC
+// status errors.
+func (a *AdminServer) lookupUser(id string) (*model.User, error) {
+	if id == "" {
+		return nil, invalidArgument(reasonMissingField, "User ID is required",
+			fieldViolation("user_id", reasonMissingField, "user_id is required"))
+	}
+
+	user, err := a.auth.userStore.GetByID(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, statusError(codes.NotFound, reasonUserNotFound, "User not found")
+	}
+	if err != nil {
+		return nil, internalError("Failed to look up user", err)
+	}
+	return user, nil
+}
+
+// Like lookupUser, but refuses the caller's own account, so admins cannot
+// lock themselves out
+func (a *AdminServer) lookupOtherUser(sessionToken, id string) (*model.User, error) {
+	claims, err := a.auth.authenticate(sessionToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == id {
+		return nil, statusError(codes.FailedPrecondition, reasonCannotTargetSelf, "Administrators cannot do this to their own account")
+	}
+	return a.lookupUser(id)
+}
+
+func userRecord(user *model.User) *proto.UserRecord {
+	return &proto.UserRecord{
+		UserId:              user.ID,
+		Username:            user.Username,
+		Email:               user.Email,
+		CreatedAt:           unixOrZero(user.CreatedAt),
+		EmailVerified:       user.EmailVerified,
+		MfaEnabled:          user.TOTPEnabled,
+		Roles:               user.Roles,
+		Permissions:         user.Permissions,
+		Disabled:            user.IsDisabled(),
+		DisabledAt:          unixOrZero(user.DisabledAt),
+		FailedLoginAttempts: int32(user.FailedLoginAttempts),
+		LockedUntil:         unixOrZero(user.LockedUntil),
+		PasswordChangedAt:   unixOrZero(user.PasswordChangedAt),
+		DeletedAt:           unixOrZero(user.DeletedAt),
+	}
+}
+
+// Unix seconds of t, 0 for the zero time
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func accountDisabledError() error {
+	return statusError(codes.PermissionDenied, reasonAccountDisabled, "Account is disabled")
+}
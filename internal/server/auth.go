@@ -2,65 +2,166 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
 	"time"
 
 	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/clientauth"
+	"github.com/automatedtomato/grpc-auth-service/internal/hashing"
+	"github.com/automatedtomato/grpc-auth-service/internal/jwt"
+	"github.com/automatedtomato/grpc-auth-service/internal/lockout"
+	"github.com/automatedtomato/grpc-auth-service/internal/mail"
 	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/passwordpolicy"
+	"github.com/automatedtomato/grpc-auth-service/internal/rbac"
 	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"github.com/automatedtomato/grpc-auth-service/internal/token"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 )
 
-// simple map to manage session token
-type sessionManager struct {
-	session map[string]string
-}
-
-func newSessionManager() *sessionManager {
-	return &sessionManager{
-		session: make(map[string]string),
-	}
-}
-
 // Implementation of gRPC authentication service
 type AuthServer struct {
 	proto.UnimplementedAuthServiceServer
-	userStore  storage.UserStore
-	sessionMgr *sessionManager
+	userStore            storage.UserStore
+	refreshTokens        storage.RefreshTokenStore
+	sessions             storage.SessionStore
+	tokens               *jwt.Issuer
+	hasher               hashing.Hasher
+	policy               *passwordpolicy.Policy
+	refreshTTL           time.Duration
+	mfaChallengeTTL      time.Duration
+	totpIssuer           string
+	lockout              lockout.Policy
+	loginAttempts        *lockout.IPTracker
+	credentials          storage.CredentialStore
+	webauthn             *webauthn.WebAuthn
+	ceremonies           *ceremonyStore
+	mailer               mail.Mailer
+	resetURL             string
+	exposeResetToken     bool
+	verifyURL            string
+	requireVerifiedEmail bool
+	hideAccounts         bool
+	hiddenResponseTime   time.Duration
+	dummyHash            string // checked for unknown usernames, see Login
+	access               *rbac.Policy
+	adminUserIDs         []string
+	purgeDelay           time.Duration
+	clients              *clientauth.Registry
 }
 
-func NewAuthServer(userStore storage.UserStore) *AuthServer {
+func NewAuthServer(cfg Config) *AuthServer {
+	access := cfg.AccessPolicy
+	if access == nil {
+		access = rbac.DefaultPolicy()
+	}
+
 	return &AuthServer{
-		userStore:  userStore,
-		sessionMgr: newSessionManager(),
+		userStore:            cfg.UserStore,
+		refreshTokens:        cfg.RefreshTokenStore,
+		sessions:             cfg.SessionStore,
+		tokens:               cfg.TokenIssuer,
+		hasher:               cfg.PasswordHasher,
+		policy:               cfg.PasswordPolicy,
+		refreshTTL:           cfg.RefreshTokenTTL,
+		mfaChallengeTTL:      cfg.MFAChallengeTTL,
+		totpIssuer:           cfg.TOTPIssuer,
+		lockout:              cfg.Lockout,
+		loginAttempts:        cfg.LoginAttempts,
+		credentials:          cfg.CredentialStore,
+		webauthn:             cfg.WebAuthn,
+		ceremonies:           newCeremonyStore(),
+		mailer:               cfg.Mailer,
+		resetURL:             cfg.ResetURL,
+		exposeResetToken:     cfg.ExposeResetToken,
+		verifyURL:            cfg.VerifyURL,
+		requireVerifiedEmail: cfg.RequireVerifiedEmail,
+		hideAccounts:         cfg.HideAccountExistence,
+		hiddenResponseTime:   cfg.HiddenResponseTime,
+		dummyHash:            dummyPasswordHash(cfg.PasswordHasher),
+		access:               access,
+		adminUserIDs:         cfg.AdminUserIDs,
+		purgeDelay:           cfg.AccountPurgeDelay,
+		clients:              cfg.Clients,
+	}
+}
+
+// Hash of a random password made with the configured hasher, so checking
+// it costs as much as checking a user's password
+func dummyPasswordHash(hasher hashing.Hasher) string {
+	hash, err := hasher.Hash(token.New(token.DefaultBytes))
+	if err != nil {
+		log.Printf("Failed to create dummy password hash: %v", err)
 	}
+	return hash
 }
 
 func (s *AuthServer) Register(ctx context.Context, req *proto.RegisterRequest) (*proto.RegisterResponse, error) {
+	if s.hideAccounts {
+		defer s.padResponse(ctx, time.Now())
+	}
 
 	// Validate input
-	if req.Username == "" || req.Email == "" || req.Password == "" {
-		return &proto.RegisterResponse{
-			Success: false,
-			Message: "Username, email and password are required",
-		}, nil
+	var missing []*errdetails.BadRequest_FieldViolation
+	for _, f := range []struct{ name, value string }{
+		{"username", req.Username},
+		{"email", req.Email},
+		{"password", req.Password},
+	} {
+		if f.value == "" {
+			missing = append(missing, fieldViolation(f.name, reasonMissingField, f.name+" is required"))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, invalidArgument(reasonMissingField, "Username, email and password are required", missing...)
+	}
+	if !validEmail(req.Email) {
+		return nil, invalidEmail()
+	}
+
+	// Enforce password policy
+	if violations := s.policy.Check(req.Password, req.Username, req.Email); len(violations) > 0 {
+		return nil, passwordPolicyError("password", violations)
 	}
 
 	// Create user
-	user, err := model.NewUser(req.Username, req.Email, req.Password)
+	user, err := model.NewUser(req.Username, req.Email, req.Password, s.hasher)
 	if err != nil {
-		return &proto.RegisterResponse{
-			Success: false,
-			Message: "Failed to create user: " + err.Error(),
-		}, nil
+		return nil, internalError("Failed to create user", err)
 	}
+	verifyToken := user.SetVerifyToken()
+	user.Roles = slices.Clone(s.access.DefaultRoles)
 
 	// save user
 	if err := s.userStore.Create(user); err != nil {
-		return &proto.RegisterResponse{
-			Success: false,
-			Message: "Failed to register user:" + err.Error(),
-		}, nil
+		switch {
+		case errors.Is(err, storage.ErrDuplicateUsername):
+			return nil, statusError(codes.AlreadyExists, reasonUsernameTaken, "Username already exists")
+		case errors.Is(err, storage.ErrDuplicateEmail):
+			if s.hideAccounts {
+				return s.registerExistingEmail(req)
+			}
+			return nil, statusError(codes.AlreadyExists, reasonEmailTaken, "Email already exists")
+		}
+		return nil, internalError("Failed to register user", err)
+	}
+
+	// The account exists at this point; a lost email can be sent again
+	// with ResendVerification
+	if err := s.sendAccountEmail("verification", func() error {
+		return s.sendVerification(user, verifyToken)
+	}); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
 	}
 
+	if s.hideAccounts {
+		return registrationReceived(), nil
+	}
 	return &proto.RegisterResponse{
 		Success: true,
 		Message: "User registered successfully",
@@ -68,63 +169,199 @@ func (s *AuthServer) Register(ctx context.Context, req *proto.RegisterRequest) (
 	}, nil
 }
 
+// Answer a registration for an email address that already has an account
+// without revealing it; the address's owner is told by email instead
+func (s *AuthServer) registerExistingEmail(req *proto.RegisterRequest) (*proto.RegisterResponse, error) {
+	// Usernames are public, so a taken one is still reported. The store may
+	// report the email conflict first when both are taken.
+	if _, err := s.userStore.GetByUsername(req.Username); err == nil {
+		return nil, statusError(codes.AlreadyExists, reasonUsernameTaken, "Username already exists")
+	}
+
+	existing, err := s.userStore.GetByEmail(req.Email)
+	if err != nil {
+		return nil, internalError("Failed to register user", err)
+	}
+	if err := s.sendAccountEmail("account exists", func() error {
+		return s.sendAccountExists(existing)
+	}); err != nil {
+		log.Printf("Failed to send account exists email to user %s: %v", existing.ID, err)
+	}
+	return registrationReceived(), nil
+}
+
+// Register response used while account existence is hidden, identical for
+// new and already registered email addresses
+func registrationReceived() *proto.RegisterResponse {
+	return &proto.RegisterResponse{
+		Success: true,
+		Message: "Registration received; check your email to continue",
+	}
+}
+
 func (s *AuthServer) Login(ctx context.Context, req *proto.LoginRequest) (*proto.LoginResponse, error) {
+	ip := clientIP(ctx)
+	if err := s.checkLoginAttempts(ip); err != nil {
+		return nil, err
+	}
+
 	// Search user by username
-	user, err := s.userStore.GetByUsername(req.Username)
+	user, err := activeUser(s.userStore.GetByUsername(req.Username))
+	if errors.Is(err, storage.ErrNotFound) {
+		// Check the password anyway, so the response time does not reveal
+		// that the username is unknown
+		hashing.Verify(req.Password, s.dummyHash)
+		s.loginFailed(ip, nil)
+		return nil, statusError(codes.Unauthenticated, reasonInvalidCredentials, "Invalid username or password")
+	}
 	if err != nil {
-		return &proto.LoginResponse{
-			Success: false,
-			Message: "Invalid username or password",
-		}, nil
+		return nil, internalError("Failed to look up user", err)
+	}
+
+	// Refuse locked accounts without checking the password, so guessing
+	// cannot continue while the lock is in place
+	if user.IsLocked() {
+		return nil, accountLockedError(user)
 	}
 
 	// Validate password
 	if !user.CheckPassword(req.Password) {
+		s.loginFailed(ip, user)
+		if user.IsLocked() {
+			return nil, accountLockedError(user)
+		}
+		return nil, statusError(codes.Unauthenticated, reasonInvalidCredentials, "Invalid username or password")
+	}
+
+	// Only reported to callers who know the password
+	if user.IsDisabled() {
+		return nil, accountDisabledError()
+	}
+
+	if err := s.checkEmailVerified(user); err != nil {
+		return nil, err
+	}
+
+	// Upgrade hashes made with an outdated algorithm or cost while the
+	// plaintext password is at hand
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		if err := user.SetPassword(req.Password, s.hasher); err != nil {
+			log.Printf("Failed to rehash password of user %s: %v", user.ID, err)
+		} else if err := s.userStore.Update(user); err != nil {
+			log.Printf("Failed to store rehashed password of user %s: %v", user.ID, err)
+		}
+	}
+
+	// With MFA enabled the password only earns a challenge; tokens are
+	// issued by VerifyMFA. Failed logins are kept until then so guessing
+	// the second factor stays limited by the account lockout.
+	if user.TOTPEnabled {
+		mfaToken, err := s.tokens.IssueChallenge(user.ID, user.Username, s.mfaChallengeTTL)
+		if err != nil {
+			return nil, internalError("Failed to issue MFA challenge", err)
+		}
 		return &proto.LoginResponse{
-			Success: false,
-			Message: "Invalid username or password",
+			Success:     true,
+			Message:     "Second factor required",
+			MfaRequired: true,
+			MfaToken:    mfaToken,
 		}, nil
 	}
 
-	// Generate session token
-	token := model.RandomString(32)
-	s.sessionMgr.session[token] = user.ID
+	s.loginSucceeded(user)
+
+	tokens, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
 
 	return &proto.LoginResponse{
 		Success:      true,
 		Message:      "Login successfully",
-		SessionToken: token,
+		SessionToken: tokens.accessToken,
+		RefreshToken: tokens.refreshToken,
+		ExpiresIn:    tokens.expiresIn,
 	}, nil
 }
 
 // Process password reset
 func (s *AuthServer) RequestPasswordReset(ctx context.Context, req *proto.PasswordResetRequest) (*proto.PasswordResetResponse, error) {
+	if req.Email == "" {
+		return nil, invalidArgument(reasonMissingField, "Email is required",
+			fieldViolation("email", reasonMissingField, "email is required"))
+	}
+	// Hidden mode mails unknown addresses, so they must be single mailboxes
+	if !validEmail(req.Email) {
+		return nil, invalidEmail()
+	}
+
+	// Answer before looking at the account, so the response time does not
+	// depend on whether it exists
+	if s.hideAccounts {
+		defer s.padResponse(ctx, time.Now())
+		go s.requestPasswordResetHidden(req.Email)
+		return resetRequested(), nil
+	}
+
 	// Search user by email
-	user, err := s.userStore.GetByEmail(req.Email)
+	user, err := activeUser(s.userStore.GetByEmail(req.Email))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, statusError(codes.NotFound, reasonAccountNotFound, "No account found with that email")
+	}
 	if err != nil {
-		return &proto.PasswordResetResponse{
-			Success: false,
-			Message: "No account found with that email",
-		}, nil
+		return nil, internalError("Failed to look up user", err)
 	}
 
-	// Generate reset token
-	resetToken := user.SetResetToken()
+	resetToken, err := s.startPasswordReset(user)
+	if err != nil {
+		return nil, internalError("Failed to process reset request", err)
+	}
 
+	resp := &proto.PasswordResetResponse{
+		Success: true,
+		Message: "Password reset link sent to your email",
+	}
+	// Development only: skip the mailbox
+	if s.exposeResetToken {
+		resp.SessionToken = resetToken
+	}
+	return resp, nil
+}
+
+// Generate a reset token for user and email it. Returns the token.
+func (s *AuthServer) startPasswordReset(user *model.User) (string, error) {
+	resetToken := user.SetResetToken()
 	if err := s.userStore.Update(user); err != nil {
-		return &proto.PasswordResetResponse{
-			Success: false,
-			Message: "Failed to process reset request",
-		}, nil
+		return "", err
 	}
+	if err := s.sendPasswordReset(user, resetToken); err != nil {
+		return "", fmt.Errorf("send password reset email: %w", err)
+	}
+	return resetToken, nil
+}
 
-	// NOTE: In a "real-world" application, you could implement email sending func etc.
-	// In this project, for the simplification purpose, just return token
+// Handle a password reset request while account existence is hidden. The
+// outcome is only told by email, to the address in the request.
+func (s *AuthServer) requestPasswordResetHidden(email string) {
+	user, err := activeUser(s.userStore.GetByEmail(email))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		err = s.sendNoAccount(email)
+	case err == nil:
+		_, err = s.startPasswordReset(user)
+	}
+	if err != nil {
+		log.Printf("Failed to process password reset request: %v", err)
+	}
+}
+
+// Password reset response used while account existence is hidden,
+// identical for known and unknown email addresses
+func resetRequested() *proto.PasswordResetResponse {
 	return &proto.PasswordResetResponse{
-		Success:      true,
-		Message:      "Password reset link sent to your email",
-		SessionToken: resetToken, // In an actual app, you don't do this!!
-	}, nil
+		Success: true,
+		Message: "If an account uses that email, a password reset link has been sent to it",
+	}
 }
 
 // Process password reset
@@ -132,39 +369,34 @@ func (s *AuthServer) ResetPassword(ctx context.Context, req *proto.NewPasswordRe
 
 	// Find user by token
 	user, err := s.userStore.GetByResetToken(req.ResetToken)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, invalidArgument(reasonInvalidResetToken, "Invalid or expired reset token",
+			fieldViolation("reset_token", reasonInvalidResetToken, "Reset token is not valid"))
+	}
 	if err != nil {
-		return &proto.NewPasswordResponse{
-			Success: false,
-			Message: "Invalid or expired reset token",
-		}, nil
+		return nil, internalError("Failed to look up reset token", err)
 	}
 
 	// Check token is expired or not
 	if user.ResetTokenExpires.Before(time.Now()) {
-		return &proto.NewPasswordResponse{
-			Success: false,
-			Message: "Reset token has expired",
-		}, nil
+		return nil, invalidArgument(reasonResetTokenExpired, "Reset token has expired",
+			fieldViolation("reset_token", reasonResetTokenExpired, "Reset token has expired"))
 	}
 
-	// Set new password
-	newUser, err := model.NewUser(user.Username, user.Email, req.NewPassword)
-	if err != nil {
-		return &proto.NewPasswordResponse{
-			Success: false,
-			Message: "Failed to update password",
-		}, nil
+	// Enforce password policy
+	if violations := s.policy.Check(req.NewPassword, user.Username, user.Email); len(violations) > 0 {
+		return nil, passwordPolicyError("new_password", violations)
 	}
 
-	user.PasswordHash = newUser.PasswordHash
-	user.ResetToken = ""
+	// Set new password
+	if err := user.ChangePassword(req.NewPassword, s.hasher); err != nil {
+		return nil, internalError("Failed to update password", err)
+	}
+	user.ClearResetToken()
 
 	// Update password via userStore interface
 	if err := s.userStore.Update(user); err != nil {
-		return &proto.NewPasswordResponse{
-			Success: false,
-			Message: "Failed to update password",
-		}, nil
+		return nil, internalError("Failed to update password", err)
 	}
 
 	return &proto.NewPasswordResponse{
@@ -173,30 +405,249 @@ func (s *AuthServer) ResetPassword(ctx context.Context, req *proto.NewPasswordRe
 	}, nil
 }
 
-func (s *AuthServer) GetUserInfo(ctx context.Context, req *proto.UserInfoRequest) (*proto.UserInfoResponse, error) {
-	// Validate session token
-	userID, exists := s.sessionMgr.session[req.SessionToken]
-	if !exists {
-		return &proto.UserInfoResponse{
-			Success: false,
-			Message: "Invalid session token",
-		}, nil
+// Change the password of the signed-in user. Other sessions are ended, since
+// they may belong to whoever knew the old password.
+func (s *AuthServer) ChangePassword(ctx context.Context, req *proto.ChangePasswordRequest) (*proto.ChangePasswordResponse, error) {
+	var missing []*errdetails.BadRequest_FieldViolation
+	for _, f := range []struct{ name, value string }{
+		{"old_password", req.OldPassword},
+		{"new_password", req.NewPassword},
+	} {
+		if f.value == "" {
+			missing = append(missing, fieldViolation(f.name, reasonMissingField, f.name+" is required"))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, invalidArgument(reasonMissingField, "Old and new passwords are required", missing...)
 	}
 
-	// Get user info
-	user, err := s.userStore.GetByID(userID)
+	user, claims, err := s.authenticatedUser(req.SessionToken)
 	if err != nil {
-		return &proto.UserInfoResponse{
-			Success: false,
-			Message: "User not found",
-		}, nil
+		return nil, err
+	}
+
+	if err := s.confirmPassword(ctx, user, "old_password", req.OldPassword); err != nil {
+		return nil, err
+	}
+
+	// Enforce password policy
+	if violations := s.policy.Check(req.NewPassword, user.Username, user.Email); len(violations) > 0 {
+		return nil, passwordPolicyError("new_password", violations)
+	}
+
+	if err := user.ChangePassword(req.NewPassword, s.hasher); err != nil {
+		return nil, internalError("Failed to update password", err)
+	}
+	user.ClearLockout()
+	if err := s.userStore.Update(user); err != nil {
+		return nil, internalError("Failed to update password", err)
+	}
+
+	revoked, err := s.endOtherSessions(user.ID, claims.SessionID)
+	if err != nil {
+		return nil, internalError("Failed to end other sessions", err)
+	}
+
+	return &proto.ChangePasswordResponse{
+		Success:         true,
+		Message:         "Password changed successfully",
+		SessionsRevoked: int32(revoked),
+	}, nil
+}
+
+func (s *AuthServer) GetUserInfo(ctx context.Context, req *proto.UserInfoRequest) (*proto.UserInfoResponse, error) {
+	// Verify session token and the session behind it, then get user info
+	user, _, err := s.authenticatedUser(req.SessionToken)
+	if err != nil {
+		return nil, err
 	}
 
 	return &proto.UserInfoResponse{
+		Success:       true,
+		Message:       "User information received successfully",
+		UserId:        user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		MfaEnabled:    user.TOTPEnabled,
+		EmailVerified: user.EmailVerified,
+		Roles:         user.Roles,
+		Permissions:   s.access.Permissions(user.Roles, user.Permissions),
+
+		RecoveryCodesRemaining: int32(len(user.RecoveryCodeHashes)),
+	}, nil
+}
+
+// Exchange a refresh token for a new access token, rotating the refresh token
+func (s *AuthServer) RefreshToken(ctx context.Context, req *proto.RefreshTokenRequest) (*proto.RefreshTokenResponse, error) {
+	// Consume refresh token
+	old, err := s.refreshTokens.Use(req.RefreshToken)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, statusError(codes.Unauthenticated, reasonInvalidRefreshToken, "Invalid refresh token")
+	}
+	if err != nil {
+		return nil, internalError("Failed to look up refresh token", err)
+	}
+
+	// A rotated token being presented again means it leaked:
+	// end the session and its whole family so neither party can keep using it
+	if old.IsUsed() || old.Revoked {
+		s.endSession(old.FamilyID)
+		return nil, statusError(codes.Unauthenticated, reasonRefreshTokenReused, "Refresh token has been revoked")
+	}
+
+	if old.ExpiresAt.Before(time.Now()) {
+		return nil, statusError(codes.Unauthenticated, reasonRefreshTokenExpired, "Refresh token has expired")
+	}
+
+	// The family belongs to a session which may have been logged out
+	if err := s.sessions.Touch(old.FamilyID); err != nil {
+		s.endSession(old.FamilyID)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return nil, internalError("Failed to look up session", err)
+		}
+		return nil, statusError(codes.Unauthenticated, reasonSessionEnded, "Session has ended")
+	}
+
+	user, err := s.userStore.GetByID(old.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, statusError(codes.NotFound, reasonUserNotFound, "User not found")
+	}
+	if err != nil {
+		return nil, internalError("Failed to look up user", err)
+	}
+	if user.IsDisabled() {
+		s.endSession(old.FamilyID)
+		return nil, accountDisabledError()
+	}
+
+	// Issue new token pair within the same family
+	tokens, err := s.issueTokens(user, old.FamilyID)
+	if err != nil {
+		return nil, internalError("Failed to issue session token", err)
+	}
+
+	return &proto.RefreshTokenResponse{
+		Success:      true,
+		Message:      "Token refreshed successfully",
+		SessionToken: tokens.accessToken,
+		RefreshToken: tokens.refreshToken,
+		ExpiresIn:    tokens.expiresIn,
+	}, nil
+}
+
+// End the current session
+func (s *AuthServer) Logout(ctx context.Context, req *proto.LogoutRequest) (*proto.LogoutResponse, error) {
+	claims, err := s.authenticate(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s.endSession(claims.SessionID)
+
+	return &proto.LogoutResponse{
+		Success: true,
+		Message: "Logged out successfully",
+	}, nil
+}
+
+// End every session of the current user
+func (s *AuthServer) LogoutAll(ctx context.Context, req *proto.LogoutAllRequest) (*proto.LogoutAllResponse, error) {
+	claims, err := s.authenticate(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.endAllSessions(claims.Subject)
+	if err != nil {
+		return nil, internalError("Failed to revoke sessions", err)
+	}
+
+	return &proto.LogoutAllResponse{
+		Success:         true,
+		Message:         "Logged out of all sessions successfully",
+		RevokedSessions: int32(revoked),
+	}, nil
+}
+
+// List active sessions of the current user
+func (s *AuthServer) ListSessions(ctx context.Context, req *proto.ListSessionsRequest) (*proto.ListSessionsResponse, error) {
+	claims, err := s.authenticate(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := s.sessions.ListByUser(claims.Subject)
+	if err != nil {
+		return nil, internalError("Failed to list sessions", err)
+	}
+
+	var sessions []*proto.Session
+	for _, session := range active {
+		sessions = append(sessions, &proto.Session{
+			SessionId: session.ID,
+			Device:    session.Device,
+			IpAddress: session.IPAddress,
+			CreatedAt: session.CreatedAt.Unix(),
+			LastSeen:  session.LastSeen.Unix(),
+			ExpiresAt: session.ExpiresAt.Unix(),
+			Current:   session.ID == claims.SessionID,
+		})
+	}
+
+	return &proto.ListSessionsResponse{
 		Success:  true,
-		Message:  "User information received successfully",
-		UserId:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+		Message:  "Sessions received successfully",
+		Sessions: sessions,
+	}, nil
+}
+
+// Start a new session, which also starts a new refresh token family, and
+// issue its tokens. Failures are returned as gRPC status errors.
+func (s *AuthServer) startSession(ctx context.Context, user *model.User) (*tokenPair, error) {
+	if user.IsDeleted() {
+		return nil, accountDeletedError()
+	}
+	if user.IsDisabled() {
+		return nil, accountDisabledError()
+	}
+
+	s.grantConfiguredRoles(user)
+
+	session := model.NewSession(user.ID, userAgent(ctx), clientIP(ctx), s.refreshTTL)
+	if err := s.sessions.Create(session); err != nil {
+		return nil, internalError("Failed to create session", err)
+	}
+
+	tokens, err := s.issueTokens(user, session.ID)
+	if err != nil {
+		return nil, internalError("Failed to issue session token", err)
+	}
+	return tokens, nil
+}
+
+// Access and refresh token pair handed out to clients
+type tokenPair struct {
+	accessToken  string
+	refreshToken string
+	expiresIn    int64
+}
+
+// Issue an access token and a refresh token for the session. The session ID
+// doubles as the refresh token family ID.
+func (s *AuthServer) issueTokens(user *model.User, sessionID string) (*tokenPair, error) {
+	accessToken, claims, err := s.tokens.Issue(user.ID, user.Username, sessionID, user.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	record, refreshToken := model.NewRefreshToken(user.ID, sessionID, s.refreshTTL)
+	if err := s.refreshTokens.Create(record); err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{
+		accessToken:  accessToken,
+		refreshToken: refreshToken,
+		expiresIn:    int64(time.Until(claims.ExpiresAt.Time).Seconds()),
 	}, nil
 }
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/hashing"
+	"github.com/automatedtomato/grpc-auth-service/internal/lockout"
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/passwordpolicy"
+	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Concurrent wrong-password logins must each count towards the lockout
+func TestConcurrentLoginFailures(t *testing.T) {
+	db, err := storage.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, tc := range []struct {
+		name  string
+		users storage.UserStore
+	}{
+		{"memory", storage.NewInMemoryUserStore()},
+		{"sql", storage.NewSQLUserStore(db)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hasher := hashing.NewBcryptHasher(bcrypt.MinCost)
+			user, err := model.NewUser("alice", "alice@example.com", "correct horse battery staple", hasher)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.users.Create(user); err != nil {
+				t.Fatal(err)
+			}
+
+			const attempts = 20
+			policy := lockout.DefaultPolicy()
+			policy.Threshold = attempts
+			s := NewAuthServer(Config{
+				UserStore:      tc.users,
+				PasswordHasher: hasher,
+				PasswordPolicy: passwordpolicy.NewPolicy(),
+				Lockout:        policy,
+			})
+
+			var wg sync.WaitGroup
+			for range attempts {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					req := &proto.LoginRequest{Username: "alice", Password: "wrong password"}
+					if _, err := s.Login(context.Background(), req); err == nil {
+						t.Error("login with a wrong password succeeded")
+					}
+				}()
+			}
+			wg.Wait()
+
+			stored, err := tc.users.GetByID(user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.FailedLoginAttempts != attempts {
+				t.Errorf("recorded %d failed logins, want %d", stored.FailedLoginAttempts, attempts)
+			}
+			if !stored.IsLocked() {
+				t.Error("account not locked after reaching the threshold")
+			}
+		})
+	}
+}
+
+// Failed logins should take as long for unknown usernames as for existing
+// users with a wrong password. Compare the ns/op of the two sub-benchmarks:
+//
+//	go test -bench=BenchmarkLoginFailure ./internal/server
+func BenchmarkLoginFailure(b *testing.B) {
+	hasher := hashing.NewArgon2idHasher()
+	users := storage.NewInMemoryUserStore()
+	user, err := model.NewUser("alice", "alice@example.com", "correct horse battery staple", hasher)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := users.Create(user); err != nil {
+		b.Fatal(err)
+	}
+
+	// No lockout and no per-IP limit, so every attempt reaches the password check
+	s := NewAuthServer(Config{
+		UserStore:      users,
+		PasswordHasher: hasher,
+		PasswordPolicy: passwordpolicy.NewPolicy(),
+	})
+
+	for _, bc := range []struct {
+		name     string
+		username string
+	}{
+		{"existing user", "alice"},
+		{"unknown user", "mallory"},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			req := &proto.LoginRequest{Username: bc.username, Password: "wrong password"}
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Login(context.Background(), req); err == nil {
+					b.Fatal("login with a wrong password succeeded")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/mail"
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+)
+
+// Email the user a link to reset their password
+func (s *AuthServer) sendPasswordReset(user *model.User, resetToken string) error {
+	link, err := withToken(s.resetURL, "token", resetToken)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mail.Render("password_reset", user.Email, map[string]any{
+		"Username": user.Username,
+		"ResetURL": link,
+		"ValidFor": fmt.Sprintf("%d hours", int(model.ResetTokenTTL.Hours())),
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(msg)
+}
+
+// Email the user a link to verify their address
+func (s *AuthServer) sendVerification(user *model.User, verifyToken string) error {
+	link, err := withToken(s.verifyURL, "verify_token", verifyToken)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mail.Render("verify_email", user.Email, map[string]any{
+		"Username":  user.Username,
+		"VerifyURL": link,
+		"ValidFor":  fmt.Sprintf("%d hours", int(model.VerifyTokenTTL.Hours())),
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(msg)
+}
+
+// Tell the owner of an address that it was used to register again
+func (s *AuthServer) sendAccountExists(user *model.User) error {
+	msg, err := mail.Render("account_exists", user.Email, map[string]any{
+		"Username": user.Username,
+		"ResetURL": s.resetURL,
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(msg)
+}
+
+// Tell the previous address of an account that its email was changed
+func (s *AuthServer) sendEmailChanged(user *model.User, oldEmail string) error {
+	msg, err := mail.Render("email_changed", oldEmail, map[string]any{
+		"Username": user.Username,
+		"NewEmail": user.Email,
+		"ResetURL": s.resetURL,
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(msg)
+}
+
+// Tell the owner of an address that another account tried to change to it
+func (s *AuthServer) sendEmailInUse(user *model.User) error {
+	msg, err := mail.Render("email_in_use", user.Email, map[string]any{
+		"Username": user.Username,
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(msg)
+}
+
+// Tell an address without an account that a password reset was requested for it
+func (s *AuthServer) sendNoAccount(email string) error {
+	msg, err := mail.Render("no_account", email, map[string]any{
+		"Email": email,
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(msg)
+}
+
+// Send an account email. While account existence is hidden the email goes
+// out in the background and failures are only logged, so neither the
+// mailer's latency nor its errors show in responses.
+func (s *AuthServer) sendAccountEmail(kind string, send func() error) error {
+	if !s.hideAccounts {
+		return send()
+	}
+	go func() {
+		if err := send(); err != nil {
+			log.Printf("Failed to send %s email: %v", kind, err)
+		}
+	}()
+	return nil
+}
+
+// Hold a response back until the hidden response time has passed since
+// start, so requests take as long whether or not an account was involved
+func (s *AuthServer) padResponse(ctx context.Context, start time.Time) {
+	wait := time.Until(start.Add(s.hiddenResponseTime))
+	if wait <= 0 {
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// Add the token to base as the query parameter called name
+func withToken(base, name, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(name, token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
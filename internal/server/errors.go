@@ -0,0 +1,124 @@
+package server
+
+import (
+	"log"
+	"net/mail"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/passwordpolicy"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain of ErrorInfo details attached to status errors
+const errorDomain = "auth.grpc-auth-service"
+
+// Machine-readable failure reasons reported in ErrorInfo details
+const (
+	reasonMissingField         = "MISSING_FIELD"
+	reasonPasswordPolicy       = "PASSWORD_POLICY"
+	reasonUsernameTaken        = "USERNAME_TAKEN"
+	reasonEmailTaken           = "EMAIL_TAKEN"
+	reasonInvalidEmail         = "INVALID_EMAIL"
+	reasonInvalidCredentials   = "INVALID_CREDENTIALS"
+	reasonAccountNotFound      = "ACCOUNT_NOT_FOUND"
+	reasonInvalidResetToken    = "INVALID_RESET_TOKEN"
+	reasonResetTokenExpired    = "RESET_TOKEN_EXPIRED"
+	reasonInvalidSession       = "INVALID_SESSION"
+	reasonInvalidRefreshToken  = "INVALID_REFRESH_TOKEN"
+	reasonRefreshTokenReused   = "REFRESH_TOKEN_REUSED"
+	reasonRefreshTokenExpired  = "REFRESH_TOKEN_EXPIRED"
+	reasonSessionEnded         = "SESSION_ENDED"
+	reasonUserNotFound         = "USER_NOT_FOUND"
+	reasonAccountLocked        = "ACCOUNT_LOCKED"
+	reasonTooManyAttempts      = "TOO_MANY_ATTEMPTS"
+	reasonRateLimited          = "RATE_LIMITED"
+	reasonMFAAlreadyEnabled    = "MFA_ALREADY_ENABLED"
+	reasonMFANotEnrolled       = "MFA_NOT_ENROLLED"
+	reasonMFANotEnabled        = "MFA_NOT_ENABLED"
+	reasonInvalidMFACode       = "INVALID_MFA_CODE"
+	reasonInvalidMFAToken      = "INVALID_MFA_TOKEN"
+	reasonPasskeysDisabled     = "PASSKEYS_DISABLED"
+	reasonPasskeyRegistered    = "PASSKEY_ALREADY_REGISTERED"
+	reasonInvalidCeremony      = "INVALID_CEREMONY"
+	reasonInvalidPasskey       = "INVALID_PASSKEY"
+	reasonInvalidVerifyToken   = "INVALID_VERIFY_TOKEN"
+	reasonVerifyTokenExpired   = "VERIFY_TOKEN_EXPIRED"
+	reasonEmailNotVerified     = "EMAIL_NOT_VERIFIED"
+	reasonEmailAlreadyVerified = "EMAIL_ALREADY_VERIFIED"
+	reasonPermissionDenied     = "PERMISSION_DENIED"
+	reasonAccountDisabled      = "ACCOUNT_DISABLED"
+	reasonCannotTargetSelf     = "CANNOT_TARGET_SELF"
+	reasonAccountDeleted       = "ACCOUNT_DELETED"
+	reasonInvalidClient        = "INVALID_CLIENT"
+	reasonIntrospectDisabled   = "INTROSPECTION_DISABLED"
+)
+
+// Status error carrying an ErrorInfo detail with reason, plus any extra details
+func statusError(code codes.Code, reason, msg string, details ...protoadapt.MessageV1) error {
+	st := status.New(code, msg)
+	info := &errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: errorDomain,
+	}
+	withDetails, err := st.WithDetails(append([]protoadapt.MessageV1{info}, details...)...)
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// InvalidArgument error listing offending request fields
+func invalidArgument(reason, msg string, violations ...*errdetails.BadRequest_FieldViolation) error {
+	if len(violations) == 0 {
+		return statusError(codes.InvalidArgument, reason, msg)
+	}
+	return statusError(codes.InvalidArgument, reason, msg, &errdetails.BadRequest{
+		FieldViolations: violations,
+	})
+}
+
+// Internal error. The cause is logged, never sent to the client.
+func internalError(msg string, cause error) error {
+	log.Printf("%s: %v", msg, cause)
+	return status.Error(codes.Internal, msg)
+}
+
+// ResourceExhausted error telling the client when to retry
+func retryLater(reason, msg string, retryAfter time.Duration) error {
+	return statusError(codes.ResourceExhausted, reason, msg, &errdetails.RetryInfo{
+		RetryDelay: durationpb.New(retryAfter),
+	})
+}
+
+func fieldViolation(field, reason, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Reason:      reason,
+		Description: description,
+	}
+}
+
+// Whether email is a bare address such as alice@example.com, without a
+// display name, a list or line breaks that would end up in mail headers
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+func invalidEmail() error {
+	return invalidArgument(reasonInvalidEmail, "Email address is invalid",
+		fieldViolation("email", reasonInvalidEmail, "email must be a plain address such as alice@example.com"))
+}
+
+// InvalidArgument error with one field violation per failed password policy rule
+func passwordPolicyError(field string, violations []passwordpolicy.Violation) error {
+	fields := make([]*errdetails.BadRequest_FieldViolation, 0, len(violations))
+	for _, v := range violations {
+		fields = append(fields, fieldViolation(field, v.Code, v.Description))
+	}
+	return invalidArgument(reasonPasswordPolicy, "Password does not meet the password policy", fields...)
+}
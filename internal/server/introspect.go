@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Describe an access token to a registered client service, after RFC 7662.
+// Scope and roles reflect the user's current access, which may be newer
+// than the roles claim in the token. Introspection is not activity of the
+// user, so it does not keep the token's session alive.
+func (s *AuthServer) Introspect(ctx context.Context, req *proto.IntrospectRequest) (*proto.IntrospectResponse, error) {
+	if err := s.authenticateClient(ctx); err != nil {
+		return nil, err
+	}
+	if req.Token == "" {
+		return nil, invalidArgument(reasonMissingField, "Token is required",
+			fieldViolation("token", reasonMissingField, "token is required"))
+	}
+
+	inactive := &proto.IntrospectResponse{Active: false}
+
+	// Any token that is not a live access token is inactive, whatever the
+	// type hint says
+	claims, err := s.checkAccessToken(req.Token)
+	if status.Code(err) == codes.Unauthenticated {
+		return inactive, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userStore.GetByID(claims.Subject)
+	if errors.Is(err, storage.ErrNotFound) {
+		return inactive, nil
+	}
+	if err != nil {
+		return nil, internalError("Failed to look up user", err)
+	}
+	if user.IsDisabled() || user.IsDeleted() {
+		return inactive, nil
+	}
+
+	return &proto.IntrospectResponse{
+		Active:    true,
+		Scope:     strings.Join(s.access.Permissions(user.Roles, user.Permissions), " "),
+		Username:  user.Username,
+		TokenType: "Bearer",
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Sub:       claims.Subject,
+		Iss:       claims.Issuer,
+		Roles:     user.Roles,
+		SessionId: claims.SessionID,
+	}, nil
+}
+
+// Check the calling client service's Basic credentials. Failures are
+// returned as gRPC status errors.
+func (s *AuthServer) authenticateClient(ctx context.Context) error {
+	if s.clients.Empty() {
+		return statusError(codes.FailedPrecondition, reasonIntrospectDisabled, "No client services are configured on this server")
+	}
+	id, secret, ok := basicCredentials(ctx)
+	if !ok || !s.clients.Authenticate(id, secret) {
+		return statusError(codes.Unauthenticated, reasonInvalidClient, "Client authentication failed")
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/api/proto"
+)
+
+// How often the signing keys are checked against the rotation schedule
+const keyRotationCheckInterval = time.Minute
+
+// Publish the public keys that verify access tokens
+func (s *AuthServer) GetJWKS(ctx context.Context, req *proto.GetJWKSRequest) (*proto.GetJWKSResponse, error) {
+	resp := &proto.GetJWKSResponse{
+		Success: true,
+		Message: "Keys received successfully",
+	}
+	for _, k := range s.tokens.Keys().PublicKeys() {
+		resp.Keys = append(resp.Keys, &proto.JSONWebKey{
+			Kty: k.Kty,
+			Kid: k.Kid,
+			Use: k.Use,
+			Alg: k.Alg,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Crv,
+			X:   k.X,
+		})
+	}
+	return resp, nil
+}
+
+// Publish, activate and retire signing keys as scheduled
+func (s *AuthServer) rotateSigningKeys() {
+	changed, err := s.tokens.Keys().Rotate(time.Now())
+	if err != nil {
+		log.Printf("Failed to rotate signing keys: %v", err)
+		return
+	}
+	if changed {
+		log.Printf("Signing keys rotated, key %s signs now", s.tokens.Keys().Current().ID)
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+)
+
+// Reject logins from an IP that has failed too often recently
+func (s *AuthServer) checkLoginAttempts(ip string) error {
+	if s.loginAttempts == nil {
+		return nil
+	}
+	if wait, blocked := s.loginAttempts.Blocked(ip); blocked {
+		return retryLater(reasonTooManyAttempts, "Too many failed login attempts, try again later", wait)
+	}
+	return nil
+}
+
+// Count a failed login against the client IP and, if known, the account
+func (s *AuthServer) loginFailed(ip string, user *model.User) {
+	if s.loginAttempts != nil {
+		s.loginAttempts.RecordFailure(ip)
+	}
+	if user == nil {
+		return
+	}
+
+	// Counted by the store itself: concurrent failures each read and write
+	// the count there, and the rest of the user is left alone
+	updated, err := s.userStore.RecordLoginFailure(user.ID, s.lockout)
+	if err != nil {
+		log.Printf("Failed to record failed login of user %s: %v", user.ID, err)
+		return
+	}
+	user.FailedLoginAttempts = updated.FailedLoginAttempts
+	user.LastFailedLogin = updated.LastFailedLogin
+	user.LockedUntil = updated.LockedUntil
+	if user.IsLocked() {
+		log.Printf("Locked user %s until %s after %d failed logins",
+			user.ID, user.LockedUntil.Format(time.RFC3339), user.FailedLoginAttempts)
+	}
+}
+
+// Forget earlier failed logins once the user has fully authenticated
+func (s *AuthServer) loginSucceeded(user *model.User) {
+	if user.FailedLoginAttempts == 0 {
+		return
+	}
+	if err := s.userStore.ClearLoginFailures(user.ID); err != nil {
+		log.Printf("Failed to clear failed logins of user %s: %v", user.ID, err)
+		return
+	}
+	user.ClearLockout()
+}
+
+// Re-check the password of a signed-in user before a sensitive change.
+// field names the request field the password came in.
+func (s *AuthServer) confirmPassword(ctx context.Context, user *model.User, field, password string) error {
+	return s.confirmUser(ctx, user, user.CheckPassword, password, func() error {
+		return invalidArgument(reasonInvalidCredentials, "Password is incorrect",
+			fieldViolation(field, reasonInvalidCredentials, "Password is incorrect"))
+	})
+}
+
+// Re-check a second factor code of a signed-in user with verify, which
+// records an accepted code on the user; the caller persists it
+func (s *AuthServer) confirmCode(ctx context.Context, user *model.User, code string, verify func(string) bool) error {
+	return s.confirmUser(ctx, user, verify, code, invalidMFACode)
+}
+
+// Wrong passwords and codes count as failed logins, so a stolen access
+// token cannot be used to guess them past the account lockout
+func (s *AuthServer) confirmUser(ctx context.Context, user *model.User, check func(string) bool, value string, wrong func() error) error {
+	if user.IsLocked() {
+		return accountLockedError(user)
+	}
+	if !check(value) {
+		s.loginFailed(clientIP(ctx), user)
+		if user.IsLocked() {
+			return accountLockedError(user)
+		}
+		return wrong()
+	}
+	return nil
+}
+
+func accountLockedError(user *model.User) error {
+	return retryLater(reasonAccountLocked, "Account is temporarily locked after too many failed logins",
+		time.Until(user.LockedUntil))
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"github.com/automatedtomato/grpc-auth-service/internal/totp"
+	"google.golang.org/grpc/codes"
+)
+
+// Start TOTP enrollment. The secret only protects logins after ConfirmTOTP.
+func (s *AuthServer) EnrollTOTP(ctx context.Context, req *proto.EnrollTOTPRequest) (*proto.EnrollTOTPResponse, error) {
+	user, _, err := s.authenticatedUser(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, statusError(codes.FailedPrecondition, reasonMFAAlreadyEnabled, "TOTP is already enabled")
+	}
+
+	secret := user.EnrollTOTP()
+	if err := s.userStore.Update(user); err != nil {
+		return nil, internalError("Failed to store TOTP secret", err)
+	}
+
+	return &proto.EnrollTOTPResponse{
+		Success:    true,
+		Message:    "Add the secret to your authenticator app, then confirm with a code",
+		Secret:     secret,
+		OtpauthUri: totp.URI(s.totpIssuer, user.Username, secret),
+	}, nil
+}
+
+// Turn on TOTP once the user proves their authenticator app produces codes
+func (s *AuthServer) ConfirmTOTP(ctx context.Context, req *proto.ConfirmTOTPRequest) (*proto.ConfirmTOTPResponse, error) {
+	user, _, err := s.authenticatedUser(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, statusError(codes.FailedPrecondition, reasonMFAAlreadyEnabled, "TOTP is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, statusError(codes.FailedPrecondition, reasonMFANotEnrolled, "TOTP enrollment has not been started")
+	}
+
+	if !user.VerifyTOTP(req.Code) {
+		return nil, invalidMFACode()
+	}
+	user.TOTPEnabled = true
+	if err := s.userStore.Update(user); err != nil {
+		return nil, internalError("Failed to enable TOTP", err)
+	}
+
+	return &proto.ConfirmTOTPResponse{
+		Success: true,
+		Message: "TOTP enabled successfully",
+	}, nil
+}
+
+// Turn off TOTP. A current code or a recovery code is required so a stolen
+// access token alone cannot remove the second factor.
+func (s *AuthServer) DisableTOTP(ctx context.Context, req *proto.DisableTOTPRequest) (*proto.DisableTOTPResponse, error) {
+	user, _, err := s.authenticatedUser(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, statusError(codes.FailedPrecondition, reasonMFANotEnabled, "TOTP is not enabled")
+	}
+
+	if err := s.confirmCode(ctx, user, req.Code, func(code string) bool {
+		return verifySecondFactor(user, code)
+	}); err != nil {
+		return nil, err
+	}
+	user.DisableTOTP()
+	if err := s.userStore.Update(user); err != nil {
+		return nil, internalError("Failed to disable TOTP", err)
+	}
+
+	return &proto.DisableTOTPResponse{
+		Success: true,
+		Message: "TOTP disabled successfully",
+	}, nil
+}
+
+// Complete a login with the challenge token from Login and a TOTP or
+// recovery code
+func (s *AuthServer) VerifyMFA(ctx context.Context, req *proto.VerifyMFARequest) (*proto.VerifyMFAResponse, error) {
+	ip := clientIP(ctx)
+	if err := s.checkLoginAttempts(ip); err != nil {
+		return nil, err
+	}
+
+	claims, err := s.tokens.VerifyChallenge(req.MfaToken)
+	if err != nil {
+		return nil, statusError(codes.Unauthenticated, reasonInvalidMFAToken, "Invalid or expired MFA token")
+	}
+
+	user, err := s.userStore.GetByID(claims.Subject)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, statusError(codes.Unauthenticated, reasonInvalidMFAToken, "Invalid or expired MFA token")
+	}
+	if err != nil {
+		return nil, internalError("Failed to look up user", err)
+	}
+
+	if user.IsLocked() {
+		return nil, accountLockedError(user)
+	}
+	// MFA may have been turned off since the challenge was issued
+	if !user.TOTPEnabled {
+		return nil, statusError(codes.FailedPrecondition, reasonMFANotEnabled, "TOTP is not enabled")
+	}
+
+	// Wrong codes count as failed logins, so the account lockout bounds
+	// how many codes can be guessed
+	if !verifySecondFactor(user, req.Code) {
+		s.loginFailed(ip, user)
+		if user.IsLocked() {
+			return nil, accountLockedError(user)
+		}
+		return nil, invalidMFACode()
+	}
+
+	// Persist the accepted time step or used recovery code so the code
+	// cannot be replayed
+	if err := s.userStore.Update(user); err != nil {
+		return nil, internalError("Failed to record TOTP code", err)
+	}
+	s.loginSucceeded(user)
+
+	tokens, err := s.startSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.VerifyMFAResponse{
+		Success:      true,
+		Message:      "Login successfully",
+		SessionToken: tokens.accessToken,
+		RefreshToken: tokens.refreshToken,
+		ExpiresIn:    tokens.expiresIn,
+	}, nil
+}
+
+// Replace the user's recovery codes. Only available with MFA enabled, since
+// the codes stand in for the second factor. A current TOTP code or the
+// password is required so a stolen access token alone cannot mint codes.
+func (s *AuthServer) GenerateRecoveryCodes(ctx context.Context, req *proto.GenerateRecoveryCodesRequest) (*proto.GenerateRecoveryCodesResponse, error) {
+	if req.Code == "" && req.Password == "" {
+		return nil, invalidArgument(reasonMissingField, "TOTP code or password is required",
+			fieldViolation("code", reasonMissingField, "TOTP code or password is required"),
+			fieldViolation("password", reasonMissingField, "TOTP code or password is required"))
+	}
+
+	user, _, err := s.authenticatedUser(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, statusError(codes.FailedPrecondition, reasonMFANotEnabled, "TOTP is not enabled")
+	}
+
+	if req.Code != "" {
+		err = s.confirmCode(ctx, user, req.Code, user.VerifyTOTP)
+	} else {
+		err = s.confirmPassword(ctx, user, "password", req.Password)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes := user.GenerateRecoveryCodes()
+	if err := s.userStore.Update(user); err != nil {
+		return nil, internalError("Failed to store recovery codes", err)
+	}
+
+	return &proto.GenerateRecoveryCodesResponse{
+		Success:       true,
+		Message:       "Store these codes somewhere safe; each can be used once",
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// Accept a TOTP code, or a recovery code in its place
+func verifySecondFactor(user *model.User, code string) bool {
+	if len(code) == totp.Digits && user.VerifyTOTP(code) {
+		return true
+	}
+	return user.UseRecoveryCode(code)
+}
+
+func invalidMFACode() error {
+	return invalidArgument(reasonInvalidMFACode, "Invalid authentication code",
+		fieldViolation("code", reasonInvalidMFACode, "Code is wrong, expired or already used"))
+}
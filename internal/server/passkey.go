@@ -0,0 +1,440 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"github.com/automatedtomato/grpc-auth-service/internal/token"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"google.golang.org/grpc/codes"
+)
+
+// How long a browser has to complete a WebAuthn ceremony
+const ceremonyTTL = 5 * time.Minute
+
+// Start registering a passkey for the current user. A passkey logs in
+// without password or second factor, so one of those is required here,
+// as in DisableTOTP, and a stolen access token alone cannot add one.
+func (s *AuthServer) BeginPasskeyRegistration(ctx context.Context, req *proto.BeginPasskeyRegistrationRequest) (*proto.BeginPasskeyRegistrationResponse, error) {
+	if err := s.requireWebAuthn(); err != nil {
+		return nil, err
+	}
+	if req.Password == "" && req.Code == "" {
+		return nil, invalidArgument(reasonMissingField, "Password or authentication code is required",
+			fieldViolation("password", reasonMissingField, "password or authentication code is required"),
+			fieldViolation("code", reasonMissingField, "password or authentication code is required"))
+	}
+	user, _, err := s.authenticatedUser(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Password != "" {
+		if err := s.confirmPassword(ctx, user, "password", req.Password); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.confirmCode(ctx, user, req.Code, func(code string) bool {
+			return user.TOTPEnabled && verifySecondFactor(user, code)
+		}); err != nil {
+			return nil, err
+		}
+		// Persist the accepted time step or used recovery code so the code
+		// cannot be replayed
+		if err := s.userStore.Update(user); err != nil {
+			return nil, internalError("Failed to record authentication code", err)
+		}
+	}
+
+	wu, err := s.webAuthnUser(user)
+	if err != nil {
+		return nil, internalError("Failed to list passkeys", err)
+	}
+
+	// Passkeys must be discoverable so they can be used without a username,
+	// and the same authenticator must not be registered twice
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(wu.creds))
+	for _, cred := range wu.creds {
+		exclusions = append(exclusions, cred.Descriptor())
+	}
+	creation, session, err := s.webauthn.BeginRegistration(wu,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		return nil, internalError("Failed to start passkey registration", err)
+	}
+
+	options, err := json.Marshal(creation)
+	if err != nil {
+		return nil, internalError("Failed to start passkey registration", err)
+	}
+
+	return &proto.BeginPasskeyRegistrationResponse{
+		Success:     true,
+		Message:     "Create a passkey with the given options",
+		CeremonyId:  s.ceremonies.put(session, user.ID, true),
+		OptionsJson: string(options),
+	}, nil
+}
+
+// Verify and store the passkey created by the browser
+func (s *AuthServer) FinishPasskeyRegistration(ctx context.Context, req *proto.FinishPasskeyRegistrationRequest) (*proto.FinishPasskeyRegistrationResponse, error) {
+	if err := s.requireWebAuthn(); err != nil {
+		return nil, err
+	}
+	user, _, err := s.authenticatedUser(req.SessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	c, ok := s.ceremonies.take(req.CeremonyId)
+	if !ok || !c.registration || c.userID != user.ID {
+		return nil, invalidCeremony()
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes([]byte(req.CredentialJson))
+	if err != nil {
+		return nil, invalidPasskeyResponse(err)
+	}
+	wu, err := s.webAuthnUser(user)
+	if err != nil {
+		return nil, internalError("Failed to list passkeys", err)
+	}
+	created, err := s.webauthn.CreateCredential(wu, c.session, parsed)
+	if err != nil {
+		return nil, invalidPasskeyResponse(err)
+	}
+
+	cred := &model.Credential{
+		ID:              created.ID,
+		UserID:          user.ID,
+		Name:            req.Name,
+		PublicKey:       created.PublicKey,
+		AttestationType: created.AttestationType,
+		AAGUID:          created.Authenticator.AAGUID,
+		SignCount:       created.Authenticator.SignCount,
+		Flags:           uint8(created.Flags.ProtocolValue()),
+		CreatedAt:       time.Now(),
+	}
+	for _, t := range created.Transport {
+		cred.Transports = append(cred.Transports, string(t))
+	}
+	if cred.Name == "" {
+		cred.Name = "Passkey"
+	}
+
+	if err := s.credentials.Create(cred); err != nil {
+		if errors.Is(err, storage.ErrDuplicateCredential) {
+			return nil, statusError(codes.AlreadyExists, reasonPasskeyRegistered, "Passkey is already registered")
+		}
+		return nil, internalError("Failed to store passkey", err)
+	}
+
+	return &proto.FinishPasskeyRegistrationResponse{
+		Success:      true,
+		Message:      "Passkey registered successfully",
+		CredentialId: base64.RawURLEncoding.EncodeToString(cred.ID),
+	}, nil
+}
+
+// Start a passwordless login. With a known username only that user's
+// passkeys are offered; otherwise the browser picks a discoverable one.
+func (s *AuthServer) BeginPasskeyLogin(ctx context.Context, req *proto.BeginPasskeyLoginRequest) (*proto.BeginPasskeyLoginResponse, error) {
+	if err := s.requireWebAuthn(); err != nil {
+		return nil, err
+	}
+
+	var wu *webAuthnUser
+	if req.Username != "" {
+		user, err := activeUser(s.userStore.GetByUsername(req.Username))
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, internalError("Failed to look up user", err)
+		}
+		// Unknown users and users without passkeys fall back to a
+		// discoverable login
+		if user != nil {
+			if wu, err = s.webAuthnUser(user); err != nil {
+				return nil, internalError("Failed to list passkeys", err)
+			}
+			if len(wu.creds) == 0 {
+				wu = nil
+			}
+		}
+	}
+
+	// The passkey replaces both the password and the second factor, so the
+	// authenticator must verify the user (PIN, biometrics)
+	uv := webauthn.WithUserVerification(protocol.VerificationRequired)
+
+	var (
+		assertion *protocol.CredentialAssertion
+		session   *webauthn.SessionData
+		userID    string
+		err       error
+	)
+	if wu != nil {
+		assertion, session, err = s.webauthn.BeginLogin(wu, uv)
+		userID = wu.user.ID
+	} else {
+		assertion, session, err = s.webauthn.BeginDiscoverableLogin(uv)
+	}
+	if err != nil {
+		return nil, internalError("Failed to start passkey login", err)
+	}
+
+	options, err := json.Marshal(assertion)
+	if err != nil {
+		return nil, internalError("Failed to start passkey login", err)
+	}
+
+	return &proto.BeginPasskeyLoginResponse{
+		Success:     true,
+		Message:     "Sign in with a passkey using the given options",
+		CeremonyId:  s.ceremonies.put(session, userID, false),
+		OptionsJson: string(options),
+	}, nil
+}
+
+// Verify the browser's assertion and start a session
+func (s *AuthServer) FinishPasskeyLogin(ctx context.Context, req *proto.FinishPasskeyLoginRequest) (*proto.FinishPasskeyLoginResponse, error) {
+	if err := s.requireWebAuthn(); err != nil {
+		return nil, err
+	}
+	ip := clientIP(ctx)
+	if err := s.checkLoginAttempts(ip); err != nil {
+		return nil, err
+	}
+
+	c, ok := s.ceremonies.take(req.CeremonyId)
+	if !ok || c.registration {
+		return nil, invalidCeremony()
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes([]byte(req.CredentialJson))
+	if err != nil {
+		return nil, invalidPasskeyResponse(err)
+	}
+
+	var (
+		wu        *webAuthnUser
+		validated *webauthn.Credential
+	)
+	if c.userID != "" {
+		// The user may have been deleted since the ceremony started
+		user, err := activeUser(s.userStore.GetByID(c.userID))
+		if errors.Is(err, storage.ErrNotFound) {
+			s.loginFailed(ip, nil)
+			return nil, invalidPasskeyResponse(err)
+		}
+		if err != nil {
+			return nil, internalError("Failed to look up user", err)
+		}
+		if wu, err = s.webAuthnUser(user); err != nil {
+			return nil, internalError("Failed to list passkeys", err)
+		}
+		validated, err = s.webauthn.ValidateLogin(wu, c.session, parsed)
+	} else {
+		// The user handle stored in the passkey is the user ID
+		var found webauthn.User
+		found, validated, err = s.webauthn.ValidatePasskeyLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			user, err := activeUser(s.userStore.GetByID(string(userHandle)))
+			if err != nil {
+				return nil, err
+			}
+			return s.webAuthnUser(user)
+		}, c.session, parsed)
+		if err == nil {
+			wu = found.(*webAuthnUser)
+		}
+	}
+	if err != nil {
+		s.loginFailed(ip, nil)
+		return nil, invalidPasskeyResponse(err)
+	}
+
+	// A sign count that did not increase means the private key may have
+	// been copied off the authenticator
+	if validated.Authenticator.CloneWarning {
+		log.Printf("Rejected passkey login of user %s: possible cloned authenticator", wu.user.ID)
+		return nil, statusError(codes.Unauthenticated, reasonInvalidPasskey, "Passkey could not be verified")
+	}
+
+	if err := s.checkEmailVerified(wu.user); err != nil {
+		return nil, err
+	}
+
+	if err := s.recordPasskeyUse(validated.ID, validated.Authenticator.SignCount, uint8(parsed.Response.AuthenticatorData.Flags)); err != nil {
+		return nil, internalError("Failed to update passkey", err)
+	}
+
+	tokens, err := s.startSession(ctx, wu.user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.FinishPasskeyLoginResponse{
+		Success:      true,
+		Message:      "Login successfully",
+		SessionToken: tokens.accessToken,
+		RefreshToken: tokens.refreshToken,
+		ExpiresIn:    tokens.expiresIn,
+	}, nil
+}
+
+func (s *AuthServer) requireWebAuthn() error {
+	if s.webauthn == nil {
+		return statusError(codes.FailedPrecondition, reasonPasskeysDisabled, "Passkeys are not configured on this server")
+	}
+	return nil
+}
+
+func (s *AuthServer) recordPasskeyUse(id []byte, signCount uint32, flags uint8) error {
+	cred, err := s.credentials.GetByID(id)
+	if err != nil {
+		return err
+	}
+	cred.SignCount = signCount
+	cred.Flags = flags
+	cred.LastUsedAt = time.Now()
+	return s.credentials.Update(cred)
+}
+
+func invalidCeremony() error {
+	return statusError(codes.FailedPrecondition, reasonInvalidCeremony, "Passkey ceremony is unknown or has expired")
+}
+
+// The library's errors describe what failed verification; log them rather
+// than telling the client
+func invalidPasskeyResponse(err error) error {
+	var protoErr *protocol.Error
+	if errors.As(err, &protoErr) {
+		log.Printf("Passkey verification failed: %s (%s)", protoErr.Details, protoErr.DevInfo)
+	} else {
+		log.Printf("Passkey verification failed: %v", err)
+	}
+	return statusError(codes.Unauthenticated, reasonInvalidPasskey, "Passkey could not be verified")
+}
+
+// Adapts a user and their stored credentials to webauthn.User
+type webAuthnUser struct {
+	user  *model.User
+	creds []webauthn.Credential
+}
+
+func (s *AuthServer) webAuthnUser(user *model.User) (*webAuthnUser, error) {
+	stored, err := s.credentials.ListByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	wu := &webAuthnUser{user: user}
+	for _, cred := range stored {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(cred.Transports))
+		for _, t := range cred.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		wu.creds = append(wu.creds, webauthn.Credential{
+			ID:              cred.ID,
+			PublicKey:       cred.PublicKey,
+			AttestationType: cred.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(cred.Flags)),
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    cred.AAGUID,
+				SignCount: cred.SignCount,
+			},
+		})
+	}
+	return wu, nil
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.creds
+}
+
+// WebAuthn ceremonies waiting for the browser's response, kept in memory
+// because they only live for a few minutes
+type ceremonyStore struct {
+	pending map[string]*ceremony
+	mu      sync.Mutex
+}
+
+type ceremony struct {
+	session      webauthn.SessionData
+	userID       string // empty for discoverable logins
+	registration bool
+	expires      time.Time
+}
+
+func newCeremonyStore() *ceremonyStore {
+	return &ceremonyStore{
+		pending: make(map[string]*ceremony),
+	}
+}
+
+// Remember a ceremony, returning its ID
+func (c *ceremonyStore) put(session *webauthn.SessionData, userID string, registration bool) string {
+	id := token.New(16)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending[id] = &ceremony{
+		session:      *session,
+		userID:       userID,
+		registration: registration,
+		expires:      time.Now().Add(ceremonyTTL),
+	}
+	return id
+}
+
+// Remove and return a ceremony; each can be completed only once
+func (c *ceremonyStore) take(id string) (*ceremony, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cer, exists := c.pending[id]
+	if !exists {
+		return nil, false
+	}
+	delete(c.pending, id)
+	if time.Now().After(cer.expires) {
+		return nil, false
+	}
+	return cer, true
+}
+
+// Drop ceremonies the browser never completed
+func (c *ceremonyStore) sweep() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, cer := range c.pending {
+		if now.After(cer.expires) {
+			delete(c.pending, id)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/netip"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Metadata key in which a proxy passes on the IP address of its client
+const forwardedForKey = "x-forwarded-for"
+
+type clientIPKey struct{}
+
+// IP address of the calling client, empty if unknown
+func clientIP(ctx context.Context) string {
+	if ip, ok := ctx.Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(ctx)
+}
+
+// Unary interceptor resolving the client IP once per call. Calls from a
+// trusted proxy are attributed to the client address it forwards; forwarded
+// addresses from anyone else are ignored.
+func clientIPInterceptor(trusted []netip.Prefix) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(context.WithValue(ctx, clientIPKey{}, forwardedIP(ctx, trusted)), req)
+	}
+}
+
+// Client IP forwarded by a trusted proxy, or the peer's own address
+func forwardedIP(ctx context.Context, trusted []netip.Prefix) string {
+	ip := peerIP(ctx)
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !containsAddr(trusted, addr.Unmap()) {
+		return ip
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ip
+	}
+	values := md.Get(forwardedForKey)
+	if len(values) == 0 {
+		return ip
+	}
+	// Only the last entry was added by the proxy itself; earlier ones
+	// come from whoever called it
+	entries := strings.Split(values[len(values)-1], ",")
+	forwarded, err := netip.ParseAddr(strings.TrimSpace(entries[len(entries)-1]))
+	if err != nil {
+		return ip
+	}
+	return forwarded.Unmap().String()
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IP address of the connection's remote end, empty if unknown
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// User agent reported by the calling client, empty if unknown
+func userAgent(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get("user-agent"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Client ID and secret from "authorization: Basic ..." metadata
+func basicCredentials(ctx context.Context) (id, secret string, ok bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", "", false
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", "", false
+	}
+	scheme, encoded, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/jwt"
+	"github.com/automatedtomato/grpc-auth-service/internal/ratelimit"
+	"google.golang.org/grpc"
+)
+
+// Requests that carry an access token
+type sessionTokenRequest interface {
+	GetSessionToken() string
+}
+
+// Unary interceptor enforcing the configured limits per client IP, per
+// method and per authenticated user
+func rateLimitInterceptor(limiter ratelimit.Limiter, cfg *ratelimit.Config, tokens *jwt.Issuer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		limits := cfg.For(info.FullMethod)
+
+		if limits.IP != nil {
+			if ip := clientIP(ctx); ip != "" {
+				if wait, ok := limiter.Allow("ip|"+info.FullMethod+"|"+ip, *limits.IP); !ok {
+					return nil, retryLater(reasonRateLimited, "Too many requests, try again later", wait)
+				}
+			}
+		}
+
+		// Only count requests with a valid token against a user; the handler
+		// rejects the others anyway
+		if limits.User != nil && tokens != nil {
+			if r, ok := req.(sessionTokenRequest); ok && r.GetSessionToken() != "" {
+				if claims, err := tokens.Verify(r.GetSessionToken()); err == nil {
+					if wait, ok := limiter.Allow("user|"+info.FullMethod+"|"+claims.Subject, *limits.User); !ok {
+						return nil, retryLater(reasonRateLimited, "Too many requests, try again later", wait)
+					}
+				}
+			}
+		}
+
+		// The shared method budget is charged last, so a client already over
+		// its own limits cannot use it up for everyone else
+		if limits.Method != nil {
+			if wait, ok := limiter.Allow("method|"+info.FullMethod, *limits.Method); !ok {
+				return nil, retryLater(reasonRateLimited, "Service is busy, try again later", wait)
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
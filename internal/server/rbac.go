@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/rbac"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Unary interceptor requiring the permission the access policy assigns to
+// each RPC. The caller's roles are read from the user record rather than the
+// token, so role changes apply immediately.
+func (s *AuthServer) authorizeInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		permission := s.access.Required(info.FullMethod)
+		if permission == "" && strings.HasPrefix(info.FullMethod, adminServicePrefix) {
+			// Never leave admin RPCs open because a policy file forgot them
+			permission = rbac.Wildcard
+		}
+		if permission == "" {
+			return handler(ctx, req)
+		}
+
+		r, ok := req.(sessionTokenRequest)
+		if !ok {
+			// A policy entry for an RPC that takes no access token
+			log.Printf("Permission %q required for %s, which carries no session token", permission, info.FullMethod)
+			return nil, statusError(codes.PermissionDenied, reasonPermissionDenied, "Permission denied")
+		}
+
+		user, _, err := s.authenticatedUser(r.GetSessionToken())
+		if err != nil {
+			return nil, err
+		}
+		if !s.access.Allows(user.Roles, user.Permissions, permission) {
+			return nil, statusError(codes.PermissionDenied, reasonPermissionDenied, "Missing permission "+permission)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Give users listed as admins in the configuration the admin role. They are
+// listed by ID, which unlike the username no user can choose or change.
+func (s *AuthServer) grantConfiguredRoles(user *model.User) {
+	if !slices.Contains(s.adminUserIDs, user.ID) || !user.AddRole(rbac.AdminRole) {
+		return
+	}
+	if err := s.userStore.Update(user); err != nil {
+		log.Printf("Failed to grant role %s to user %s: %v", rbac.AdminRole, user.ID, err)
+		return
+	}
+	log.Printf("Granted role %s to user %s", rbac.AdminRole, user.ID)
+}
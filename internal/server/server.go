@@ -4,24 +4,112 @@ import (
 	"crypto/tls"
 	"log"
 	"net"
+	"net/netip"
+	"sync"
+	"time"
 
 	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/clientauth"
+	"github.com/automatedtomato/grpc-auth-service/internal/hashing"
+	"github.com/automatedtomato/grpc-auth-service/internal/jwt"
+	"github.com/automatedtomato/grpc-auth-service/internal/lockout"
+	"github.com/automatedtomato/grpc-auth-service/internal/mail"
+	"github.com/automatedtomato/grpc-auth-service/internal/passwordpolicy"
+	"github.com/automatedtomato/grpc-auth-service/internal/ratelimit"
+	"github.com/automatedtomato/grpc-auth-service/internal/rbac"
 	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
 
+// Server configuration
+type Config struct {
+	UseTLS   bool
+	CertFile string
+	KeyFile  string
+
+	UserStore         storage.UserStore
+	RefreshTokenStore storage.RefreshTokenStore
+	SessionStore      storage.SessionStore
+	CredentialStore   storage.CredentialStore
+	TokenIssuer       *jwt.Issuer
+	PasswordHasher    hashing.Hasher
+	PasswordPolicy    *passwordpolicy.Policy
+	RefreshTokenTTL   time.Duration
+
+	// Lifetime of the challenge token between Login and VerifyMFA
+	MFAChallengeTTL time.Duration
+	// Issuer shown in authenticator apps
+	TOTPIssuer string
+
+	// How often expired sessions and login attempts are removed, and
+	// deleted accounts purged
+	SessionSweepInterval time.Duration
+	// How long an account deleted by its owner is kept before it is purged.
+	// Until then an administrator can restore it with RestoreUser.
+	AccountPurgeDelay time.Duration
+
+	// Brute-force protection of Login, per account and per client IP
+	Lockout       lockout.Policy
+	LoginAttempts *lockout.IPTracker
+
+	// Delivery of account emails
+	Mailer mail.Mailer
+	// Page that completes a password reset; the token is added as the
+	// "token" query parameter
+	ResetURL string
+	// Also return reset tokens in RequestPasswordReset responses. For
+	// development only.
+	ExposeResetToken bool
+	// Page that completes email verification; the token is added as the
+	// "verify_token" query parameter
+	VerifyURL string
+	// Refuse logins until the account's email address is verified
+	RequireVerifiedEmail bool
+	// Answer Register, RequestPasswordReset and ResendVerification the same
+	// whether or not an account uses the email address, and send account
+	// emails in the background. The real outcome is only told by email.
+	HideAccountExistence bool
+	// Minimum response time of those RPCs while account existence is
+	// hidden, covering the extra work done for existing accounts
+	HiddenResponseTime time.Duration
+
+	// Relying party for passkeys; nil disables the passkey RPCs
+	WebAuthn *webauthn.WebAuthn
+
+	// Roles, permissions and the permission each RPC requires; nil uses
+	// rbac.DefaultPolicy
+	AccessPolicy *rbac.Policy
+	// IDs of users given the admin role when they log in
+	AdminUserIDs []string
+
+	// Client services allowed to call Introspect; nil disables it
+	Clients *clientauth.Registry
+
+	// Proxies whose forwarded client IP is used in place of their own
+	// address, for per-IP limits and lockouts
+	TrustedProxies []netip.Prefix
+
+	// Request rate limits; nil RateLimiter disables limiting
+	RateLimiter ratelimit.Limiter
+	RateLimits  *ratelimit.Config
+}
+
 type GRPCServer struct {
-	server    *grpc.Server
-	userStore storage.UserStore
+	server   *grpc.Server
+	auth     *AuthServer
+	cfg      Config
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
-func NewGRPCServer(useTLS bool, certFile, keyFile string) (*GRPCServer, error) {
+func NewGRPCServer(cfg Config) (*GRPCServer, error) {
 	var opts []grpc.ServerOption
 
-	if useTLS {
+	if cfg.UseTLS {
 		// TLS configuration
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
 		if err != nil {
 			return nil, err
 		}
@@ -29,18 +117,39 @@ func NewGRPCServer(useTLS bool, certFile, keyFile string) (*GRPCServer, error) {
 		opts = append(opts, grpc.Creds(creds))
 	}
 
+	authServer := NewAuthServer(cfg)
+
+	// Rate limits apply before anything else, including authorization,
+	// once the client IP is known
+	var interceptors []grpc.UnaryServerInterceptor
+	if len(cfg.TrustedProxies) > 0 {
+		interceptors = append(interceptors, clientIPInterceptor(cfg.TrustedProxies))
+	}
+	if cfg.RateLimiter != nil {
+		limits := cfg.RateLimits
+		if limits == nil {
+			limits = ratelimit.DefaultConfig()
+		}
+		interceptors = append(interceptors, rateLimitInterceptor(cfg.RateLimiter, limits, cfg.TokenIssuer))
+	}
+	interceptors = append(interceptors, authServer.authorizeInterceptor())
+	opts = append(opts, grpc.ChainUnaryInterceptor(interceptors...))
+
 	// Create gRPC server
 	server := grpc.NewServer(opts...)
 	return &GRPCServer{
-		server:    server,
-		userStore: storage.NewInMemoryUserStore(),
+		server: server,
+		auth:   authServer,
+		cfg:    cfg,
+		done:   make(chan struct{}),
 	}, nil
 }
 
 func (s *GRPCServer) Start(address string) error {
 	//  Register authentication service
-	authServer := NewAuthServer(s.userStore)
+	authServer := s.auth
 	proto.RegisterAuthServiceServer(s.server, authServer)
+	proto.RegisterAdminServiceServer(s.server, NewAdminServer(authServer))
 
 	// Create listener
 	listener, err := net.Listen("tcp", address)
@@ -48,10 +157,45 @@ func (s *GRPCServer) Start(address string) error {
 		return err
 	}
 
+	// Start background session sweeper
+	if s.cfg.SessionSweepInterval > 0 {
+		go sweepSessions(s.cfg.SessionStore, s.cfg.SessionSweepInterval, s.done)
+		if s.cfg.LoginAttempts != nil {
+			go runEvery(s.cfg.SessionSweepInterval, s.done, s.cfg.LoginAttempts.Sweep)
+		}
+		go runEvery(s.cfg.SessionSweepInterval, s.done, authServer.ceremonies.sweep)
+		go runEvery(s.cfg.SessionSweepInterval, s.done, authServer.purgeDeletedAccounts)
+		go runEvery(s.cfg.SessionSweepInterval, s.done, authServer.deleteExpiredRefreshTokens)
+		if limiter, ok := s.cfg.RateLimiter.(*ratelimit.MemoryLimiter); ok {
+			go runEvery(s.cfg.SessionSweepInterval, s.done, limiter.Sweep)
+		}
+	}
+
+	// Start signing key rotation; a no-op for a single configured key
+	go runEvery(keyRotationCheckInterval, s.done, authServer.rotateSigningKeys)
+
 	log.Printf("Starting gRPC server %s", address)
 	return s.server.Serve(listener)
 }
 
 func (s *GRPCServer) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
 	s.server.GracefulStop()
 }
+
+// Call fn every interval until done is closed
+func runEvery(interval time.Duration, done <-chan struct{}, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
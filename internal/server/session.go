@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/jwt"
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"google.golang.org/grpc/codes"
+)
+
+// Verify an access token and check that its session is still active,
+// counting the call as activity on the session. Failures are returned as
+// gRPC status errors.
+func (s *AuthServer) authenticate(token string) (*jwt.Claims, error) {
+	claims, err := s.checkAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+	// The session may have expired since Get
+	if err := s.sessions.Touch(claims.SessionID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, invalidSession()
+		}
+		return nil, internalError("Failed to update session", err)
+	}
+	return claims, nil
+}
+
+// Like authenticate, but leaves the session's last activity alone
+func (s *AuthServer) checkAccessToken(token string) (*jwt.Claims, error) {
+	claims, err := s.tokens.Verify(token)
+	if err != nil {
+		return nil, invalidSession()
+	}
+
+	session, err := s.sessions.Get(claims.SessionID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, invalidSession()
+	}
+	if err != nil {
+		return nil, internalError("Failed to look up session", err)
+	}
+	if session.UserID != claims.Subject {
+		return nil, invalidSession()
+	}
+	return claims, nil
+}
+
+func invalidSession() error {
+	return statusError(codes.Unauthenticated, reasonInvalidSession, "Invalid session token")
+}
+
+// Authenticate the access token and load its user. Failures are returned as
+// gRPC status errors.
+func (s *AuthServer) authenticatedUser(token string) (*model.User, *jwt.Claims, error) {
+	claims, err := s.authenticate(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.userStore.GetByID(claims.Subject)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, statusError(codes.NotFound, reasonUserNotFound, "User not found")
+	}
+	if err != nil {
+		return nil, nil, internalError("Failed to look up user", err)
+	}
+	return user, claims, nil
+}
+
+// Revoke a session along with its refresh token family
+func (s *AuthServer) endSession(sessionID string) {
+	if err := s.sessions.Delete(sessionID); err != nil {
+		log.Printf("Failed to delete session %s: %v", sessionID, err)
+	}
+	if err := s.refreshTokens.RevokeFamily(sessionID); err != nil {
+		log.Printf("Failed to revoke refresh token family %s: %v", sessionID, err)
+	}
+}
+
+// Revoke every session of the user, returning how many were active
+func (s *AuthServer) endAllSessions(userID string) (int, error) {
+	ids, err := s.sessions.DeleteByUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := s.refreshTokens.RevokeFamily(id); err != nil {
+			log.Printf("Failed to revoke refresh token family %s: %v", id, err)
+		}
+	}
+	return len(ids), nil
+}
+
+// Revoke every session of the user except keepID, returning how many were ended
+func (s *AuthServer) endOtherSessions(userID, keepID string) (int, error) {
+	sessions, err := s.sessions.ListByUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	ended := 0
+	for _, session := range sessions {
+		if session.ID == keepID {
+			continue
+		}
+		s.endSession(session.ID)
+		ended++
+	}
+	return ended, nil
+}
+
+// Periodically remove expired sessions until done is closed
+func sweepSessions(store storage.SessionStore, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			removed, err := store.Sweep()
+			if err != nil {
+				log.Printf("Failed to sweep expired sessions: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Removed %d expired sessions", removed)
+			}
+		}
+	}
+}
+
+// Remove refresh tokens that can no longer be exchanged
+func (s *AuthServer) deleteExpiredRefreshTokens() {
+	removed, err := s.refreshTokens.DeleteExpired()
+	if err != nil {
+		log.Printf("Failed to delete expired refresh tokens: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Removed %d expired refresh tokens", removed)
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/storage"
+	"google.golang.org/grpc/codes"
+)
+
+// Confirm the user's email address with the token from the verification email
+func (s *AuthServer) VerifyEmail(ctx context.Context, req *proto.VerifyEmailRequest) (*proto.VerifyEmailResponse, error) {
+	if req.VerifyToken == "" {
+		return nil, invalidArgument(reasonMissingField, "Verification token is required",
+			fieldViolation("verify_token", reasonMissingField, "verify_token is required"))
+	}
+
+	user, err := s.userStore.GetByVerifyToken(req.VerifyToken)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, invalidArgument(reasonInvalidVerifyToken, "Invalid or expired verification token",
+			fieldViolation("verify_token", reasonInvalidVerifyToken, "Verification token is not valid"))
+	}
+	if err != nil {
+		return nil, internalError("Failed to look up verification token", err)
+	}
+
+	if user.VerifyTokenExpires.Before(time.Now()) {
+		return nil, invalidArgument(reasonVerifyTokenExpired, "Verification token has expired",
+			fieldViolation("verify_token", reasonVerifyTokenExpired, "Verification token has expired"))
+	}
+
+	user.MarkEmailVerified()
+	if err := s.userStore.Update(user); err != nil {
+		return nil, internalError("Failed to verify email", err)
+	}
+
+	return &proto.VerifyEmailResponse{
+		Success: true,
+		Message: "Email address verified",
+	}, nil
+}
+
+// Send a new verification email, replacing any earlier token
+func (s *AuthServer) ResendVerification(ctx context.Context, req *proto.ResendVerificationRequest) (*proto.ResendVerificationResponse, error) {
+	if req.Email == "" {
+		return nil, invalidArgument(reasonMissingField, "Email is required",
+			fieldViolation("email", reasonMissingField, "email is required"))
+	}
+
+	// Answer before looking at the account, so the response time does not
+	// depend on whether it exists
+	if s.hideAccounts {
+		defer s.padResponse(ctx, time.Now())
+		go func() {
+			if err := s.resendVerificationHidden(req.Email); err != nil {
+				log.Printf("Failed to process verification request: %v", err)
+			}
+		}()
+		return verificationRequested(), nil
+	}
+
+	user, err := activeUser(s.userStore.GetByEmail(req.Email))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, statusError(codes.NotFound, reasonAccountNotFound, "No account found with that email")
+	}
+	if err != nil {
+		return nil, internalError("Failed to look up user", err)
+	}
+
+	if user.EmailVerified {
+		return nil, statusError(codes.FailedPrecondition, reasonEmailAlreadyVerified, "Email address is already verified")
+	}
+
+	if err := s.startVerification(user); err != nil {
+		return nil, internalError("Failed to process verification request", err)
+	}
+
+	return &proto.ResendVerificationResponse{
+		Success: true,
+		Message: "Verification link sent to your email",
+	}, nil
+}
+
+// Replace the user's verification token and email the new one
+func (s *AuthServer) startVerification(user *model.User) error {
+	verifyToken := user.SetVerifyToken()
+	if err := s.userStore.Update(user); err != nil {
+		return err
+	}
+	if err := s.sendVerification(user, verifyToken); err != nil {
+		return fmt.Errorf("send verification email: %w", err)
+	}
+	return nil
+}
+
+// Handle a resend request while account existence is hidden. Nothing is
+// sent for unknown or already verified addresses.
+func (s *AuthServer) resendVerificationHidden(email string) error {
+	user, err := activeUser(s.userStore.GetByEmail(email))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return s.startVerification(user)
+}
+
+// Resend response used while account existence is hidden, identical
+// whatever the state of the account behind the email address
+func verificationRequested() *proto.ResendVerificationResponse {
+	return &proto.ResendVerificationResponse{
+		Success: true,
+		Message: "If an unverified account uses that email, a verification link has been sent to it",
+	}
+}
+
+// Refuse logins of accounts whose email address is unverified, when the
+// server requires verification
+func (s *AuthServer) checkEmailVerified(user *model.User) error {
+	if s.requireVerifiedEmail && !user.EmailVerified {
+		return statusError(codes.FailedPrecondition, reasonEmailNotVerified, "Email address has not been verified")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+)
+
+// Store of WebAuthn credentials, keyed by user ID
+type CredentialStore interface {
+	Create(cred *model.Credential) error
+	// Look up a credential by its ID, for logins that do not name the user
+	GetByID(id []byte) (*model.Credential, error)
+	ListByUser(userID string) ([]*model.Credential, error)
+	// Store the sign count, flags and last use after a login
+	Update(cred *model.Credential) error
+	// Delete all credentials of a user and return how many there were
+	DeleteByUser(userID string) (int, error)
+}
+
+type InMemoryCredentialStore struct {
+	byUser map[string][]*model.Credential
+	mu     sync.RWMutex
+}
+
+func NewInMemoryCredentialStore() *InMemoryCredentialStore {
+	return &InMemoryCredentialStore{
+		byUser: make(map[string][]*model.Credential),
+	}
+}
+
+func (s *InMemoryCredentialStore) Create(cred *model.Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.find(cred.ID) != nil {
+		return ErrDuplicateCredential
+	}
+	stored := *cred
+	s.byUser[cred.UserID] = append(s.byUser[cred.UserID], &stored)
+	return nil
+}
+
+func (s *InMemoryCredentialStore) GetByID(id []byte) (*model.Credential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cred := s.find(id)
+	if cred == nil {
+		return nil, ErrNotFound
+	}
+	copied := *cred
+	return &copied, nil
+}
+
+func (s *InMemoryCredentialStore) ListByUser(userID string) ([]*model.Credential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var creds []*model.Credential
+	for _, cred := range s.byUser[userID] {
+		copied := *cred
+		creds = append(creds, &copied)
+	}
+	return creds, nil
+}
+
+func (s *InMemoryCredentialStore) Update(cred *model.Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.find(cred.ID)
+	if stored == nil {
+		return ErrNotFound
+	}
+	*stored = *cred
+	return nil
+}
+
+func (s *InMemoryCredentialStore) DeleteByUser(userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.byUser[userID])
+	delete(s.byUser, userID)
+	return n, nil
+}
+
+// Caller must hold s.mu
+func (s *InMemoryCredentialStore) find(id []byte) *model.Credential {
+	for _, creds := range s.byUser {
+		for _, cred := range creds {
+			if bytes.Equal(cred.ID, id) {
+				return cred
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package storage
+
+import "errors"
+
+// Errors returned by every store implementation. Callers should compare with errors.Is.
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrDuplicateUsername   = errors.New("username already exists")
+	ErrDuplicateEmail      = errors.New("email already exists")
+	ErrDuplicateCredential = errors.New("credential already registered")
+)
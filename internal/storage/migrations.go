@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Schema migrations, applied in order. Never edit an entry that has been
+// released; append a new one instead.
+var migrations = []string{
+	// 1: users table
+	`CREATE TABLE users (
+		id                  TEXT PRIMARY KEY,
+		username            TEXT NOT NULL,
+		email               TEXT NOT NULL,
+		password_hash       TEXT NOT NULL,
+		created_at          TIMESTAMP NOT NULL,
+		reset_token         TEXT,
+		reset_token_expires TIMESTAMP
+	);
+	CREATE UNIQUE INDEX idx_users_username ON users (username);
+	CREATE UNIQUE INDEX idx_users_email ON users (email);
+	CREATE UNIQUE INDEX idx_users_reset_token ON users (reset_token) WHERE reset_token IS NOT NULL;`,
+
+	// 2: refresh token families
+	`CREATE TABLE refresh_tokens (
+		token      TEXT PRIMARY KEY,
+		family_id  TEXT NOT NULL,
+		user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		used_at    TIMESTAMP,
+		revoked    BOOLEAN NOT NULL DEFAULT FALSE
+	);
+	CREATE INDEX idx_refresh_tokens_family ON refresh_tokens (family_id);`,
+
+	// 3: login sessions
+	`CREATE TABLE sessions (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		device     TEXT NOT NULL,
+		ip_address TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		last_seen  TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX idx_sessions_user ON sessions (user_id);`,
+
+	// 4: keep only SHA-256 hashes of reset and refresh tokens. Existing
+	// plaintext tokens cannot be hashed in SQL, so they are discarded.
+	`UPDATE users SET reset_token = NULL, reset_token_expires = NULL;
+	DROP INDEX idx_users_reset_token;
+	ALTER TABLE users RENAME COLUMN reset_token TO reset_token_hash;
+	CREATE UNIQUE INDEX idx_users_reset_token_hash ON users (reset_token_hash) WHERE reset_token_hash IS NOT NULL;
+	DELETE FROM refresh_tokens;
+	ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;`,
+
+	// 5: brute-force protection state
+	`ALTER TABLE users ADD COLUMN failed_login_attempts INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN last_failed_login TIMESTAMP;
+	ALTER TABLE users ADD COLUMN locked_until TIMESTAMP;`,
+
+	// 6: TOTP second factor
+	`ALTER TABLE users ADD COLUMN totp_secret TEXT;
+	ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE users ADD COLUMN totp_last_counter INTEGER NOT NULL DEFAULT 0;`,
+
+	// 7: MFA recovery codes, space-separated SHA-256 hashes
+	`ALTER TABLE users ADD COLUMN recovery_code_hashes TEXT;`,
+
+	// 8: WebAuthn (passkey) credentials
+	`CREATE TABLE webauthn_credentials (
+		id               BLOB PRIMARY KEY,
+		user_id          TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		name             TEXT NOT NULL,
+		public_key       BLOB NOT NULL,
+		attestation_type TEXT NOT NULL,
+		transports       TEXT NOT NULL,
+		aaguid           BLOB,
+		sign_count       INTEGER NOT NULL,
+		flags            INTEGER NOT NULL,
+		created_at       TIMESTAMP NOT NULL,
+		last_used_at     TIMESTAMP
+	);
+	CREATE INDEX idx_webauthn_credentials_user ON webauthn_credentials (user_id);`,
+
+	// 9: email verification. Accounts created before verification existed
+	// are treated as verified so enabling the requirement does not lock
+	// them out.
+	`ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE users ADD COLUMN verify_token_hash TEXT;
+	ALTER TABLE users ADD COLUMN verify_token_expires TIMESTAMP;
+	UPDATE users SET email_verified = TRUE;
+	CREATE UNIQUE INDEX idx_users_verify_token_hash ON users (verify_token_hash) WHERE verify_token_hash IS NOT NULL;`,
+
+	// 10: time of the last password change
+	`ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMP;`,
+
+	// 11: access control, space-separated role and permission names.
+	// Existing users get the default "user" role.
+	`ALTER TABLE users ADD COLUMN roles TEXT;
+	ALTER TABLE users ADD COLUMN permissions TEXT;
+	UPDATE users SET roles = 'user';`,
+
+	// 12: accounts disabled by an administrator
+	`ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;`,
+
+	// 13: accounts deleted by their owner, purged after a delay
+	`ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+	CREATE INDEX idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;`,
+
+	// 14: expired refresh tokens are deleted periodically
+	`CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);`,
+}
+
+// Apply pending migrations to db
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/token"
+)
+
+type RefreshTokenStore interface {
+	Create(rt *model.RefreshToken) error
+	// Atomically mark the token as used, returning the record as it was
+	// before the call so callers can detect reuse. Takes the raw token.
+	Use(raw string) (*model.RefreshToken, error)
+	RevokeFamily(familyID string) error
+	// Remove expired and revoked tokens, returning how many were removed.
+	// Used tokens are kept until they expire, so their reuse is still
+	// detected.
+	DeleteExpired() (int, error)
+}
+
+type InMemoryRefreshTokenStore struct {
+	tokens   map[string]*model.RefreshToken // keyed by token hash
+	byFamily map[string]map[string]struct{} // token hashes by family ID
+	mu       sync.Mutex
+}
+
+func NewInMemoryRefreshTokenStore() *InMemoryRefreshTokenStore {
+	return &InMemoryRefreshTokenStore{
+		tokens:   make(map[string]*model.RefreshToken),
+		byFamily: make(map[string]map[string]struct{}),
+	}
+}
+
+func (s *InMemoryRefreshTokenStore) Create(rt *model.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tokens[rt.TokenHash]; exists {
+		return errors.New("refresh token already exists")
+	}
+	stored := *rt
+	s.tokens[rt.TokenHash] = &stored
+	if s.byFamily[rt.FamilyID] == nil {
+		s.byFamily[rt.FamilyID] = make(map[string]struct{})
+	}
+	s.byFamily[rt.FamilyID][rt.TokenHash] = struct{}{}
+	return nil
+}
+
+func (s *InMemoryRefreshTokenStore) Use(raw string) (*model.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := token.Hash(raw)
+	stored, exists := s.tokens[hash]
+	if !exists || !token.Equal(stored.TokenHash, hash) {
+		return nil, ErrNotFound
+	}
+	before := *stored
+	if !stored.IsUsed() {
+		stored.UsedAt = time.Now()
+	}
+	return &before, nil
+}
+
+func (s *InMemoryRefreshTokenStore) RevokeFamily(familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash := range s.byFamily[familyID] {
+		s.tokens[hash].Revoked = true
+	}
+	return nil
+}
+
+func (s *InMemoryRefreshTokenStore) DeleteExpired() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for hash, t := range s.tokens {
+		if t.Revoked || !now.Before(t.ExpiresAt) {
+			delete(s.tokens, hash)
+			delete(s.byFamily[t.FamilyID], hash)
+			if len(s.byFamily[t.FamilyID]) == 0 {
+				delete(s.byFamily, t.FamilyID)
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
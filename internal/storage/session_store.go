@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+)
+
+type SessionStore interface {
+	Create(session *model.Session) error
+	// Get a live session; expired sessions are reported as not found
+	Get(id string) (*model.Session, error)
+	// Record activity on a live session
+	Touch(id string) error
+	Delete(id string) error
+	// Delete every session of the user, returning the deleted session IDs
+	DeleteByUser(userID string) ([]string, error)
+	ListByUser(userID string) ([]*model.Session, error)
+	// Remove expired sessions, returning how many were removed
+	Sweep() (int, error)
+}
+
+type InMemorySessionStore struct {
+	sessions    map[string]*model.Session
+	byUser      map[string]map[string]struct{}
+	idleTimeout time.Duration
+	mu          sync.RWMutex
+}
+
+// Sessions expire at their ExpiresAt time, or after idleTimeout without
+// activity (no idle limit when zero)
+func NewInMemorySessionStore(idleTimeout time.Duration) *InMemorySessionStore {
+	return &InMemorySessionStore{
+		sessions:    make(map[string]*model.Session),
+		byUser:      make(map[string]map[string]struct{}),
+		idleTimeout: idleTimeout,
+	}
+}
+
+func (s *InMemorySessionStore) Create(session *model.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[session.ID]; exists {
+		return errors.New("session already exists")
+	}
+
+	stored := *session
+	s.sessions[session.ID] = &stored
+	if s.byUser[session.UserID] == nil {
+		s.byUser[session.UserID] = make(map[string]struct{})
+	}
+	s.byUser[session.UserID][session.ID] = struct{}{}
+	return nil
+}
+
+func (s *InMemorySessionStore) Get(id string) (*model.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[id]
+	if !exists || session.IsExpired(s.idleTimeout) {
+		return nil, ErrNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (s *InMemorySessionStore) Touch(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[id]
+	if !exists || session.IsExpired(s.idleTimeout) {
+		return ErrNotFound
+	}
+	session.LastSeen = time.Now()
+	return nil
+}
+
+func (s *InMemorySessionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, exists := s.sessions[id]; exists {
+		s.remove(session)
+	}
+	return nil
+}
+
+func (s *InMemorySessionStore) DeleteByUser(userID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for id := range s.byUser[userID] {
+		ids = append(ids, id)
+		delete(s.sessions, id)
+	}
+	delete(s.byUser, userID)
+	return ids, nil
+}
+
+func (s *InMemorySessionStore) ListByUser(userID string) ([]*model.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []*model.Session
+	for id := range s.byUser[userID] {
+		session := s.sessions[id]
+		if session.IsExpired(s.idleTimeout) {
+			continue
+		}
+		copied := *session
+		sessions = append(sessions, &copied)
+	}
+	return sessions, nil
+}
+
+func (s *InMemorySessionStore) Sweep() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for _, session := range s.sessions {
+		if session.IsExpired(s.idleTimeout) {
+			s.remove(session)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Caller must hold s.mu
+func (s *InMemorySessionStore) remove(session *model.Session) {
+	delete(s.sessions, session.ID)
+	if ids := s.byUser[session.UserID]; ids != nil {
+		delete(ids, session.ID)
+		if len(ids) == 0 {
+			delete(s.byUser, session.UserID)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+)
+
+const credentialColumns = `id, user_id, name, public_key, attestation_type, transports, aaguid,
+	sign_count, flags, created_at, last_used_at`
+
+// CredentialStore backed by a SQL database (SQLite)
+type SQLCredentialStore struct {
+	db *sql.DB
+}
+
+func NewSQLCredentialStore(db *sql.DB) *SQLCredentialStore {
+	return &SQLCredentialStore{db: db}
+}
+
+func (s *SQLCredentialStore) Create(cred *model.Credential) error {
+	_, err := s.db.Exec(
+		`INSERT INTO webauthn_credentials (`+credentialColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		cred.ID,
+		cred.UserID,
+		cred.Name,
+		cred.PublicKey,
+		cred.AttestationType,
+		strings.Join(cred.Transports, " "),
+		cred.AAGUID,
+		cred.SignCount,
+		cred.Flags,
+		cred.CreatedAt.UTC(),
+		nullTime(cred.LastUsedAt),
+	)
+	return mapConstraintError(err)
+}
+
+func (s *SQLCredentialStore) GetByID(id []byte) (*model.Credential, error) {
+	cred, err := scanCredential(s.db.QueryRow(`SELECT `+credentialColumns+` FROM webauthn_credentials WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return cred, err
+}
+
+func (s *SQLCredentialStore) ListByUser(userID string) ([]*model.Credential, error) {
+	rows, err := s.db.Query(
+		`SELECT `+credentialColumns+` FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []*model.Credential
+	for rows.Next() {
+		cred, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, cred)
+	}
+	return creds, rows.Err()
+}
+
+func (s *SQLCredentialStore) Update(cred *model.Credential) error {
+	res, err := s.db.Exec(
+		`UPDATE webauthn_credentials SET name = ?, sign_count = ?, flags = ?, last_used_at = ? WHERE id = ?`,
+		cred.Name,
+		cred.SignCount,
+		cred.Flags,
+		nullTime(cred.LastUsedAt),
+		cred.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLCredentialStore) DeleteByUser(userID string) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM webauthn_credentials WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func scanCredential(row rowScanner) (*model.Credential, error) {
+	var (
+		cred       model.Credential
+		transports string
+		lastUsed   sql.NullTime
+	)
+	err := row.Scan(
+		&cred.ID,
+		&cred.UserID,
+		&cred.Name,
+		&cred.PublicKey,
+		&cred.AttestationType,
+		&transports,
+		&cred.AAGUID,
+		&cred.SignCount,
+		&cred.Flags,
+		&cred.CreatedAt,
+		&lastUsed,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cred.Transports = strings.Fields(transports)
+	cred.LastUsedAt = lastUsed.Time
+	return &cred, nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/token"
+)
+
+// RefreshTokenStore backed by a SQL database (SQLite)
+type SQLRefreshTokenStore struct {
+	db *sql.DB
+}
+
+func NewSQLRefreshTokenStore(db *sql.DB) *SQLRefreshTokenStore {
+	return &SQLRefreshTokenStore{db: db}
+}
+
+func (s *SQLRefreshTokenStore) Create(rt *model.RefreshToken) error {
+	_, err := s.db.Exec(
+		`INSERT INTO refresh_tokens (token_hash, family_id, user_id, created_at, expires_at, used_at, revoked)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rt.TokenHash,
+		rt.FamilyID,
+		rt.UserID,
+		rt.CreatedAt.UTC(),
+		rt.ExpiresAt.UTC(),
+		nullTime(rt.UsedAt),
+		rt.Revoked,
+	)
+	return err
+}
+
+func (s *SQLRefreshTokenStore) Use(raw string) (*model.RefreshToken, error) {
+	hash := token.Hash(raw)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		before model.RefreshToken
+		usedAt sql.NullTime
+	)
+	err = tx.QueryRow(
+		`SELECT token_hash, family_id, user_id, created_at, expires_at, used_at, revoked
+		FROM refresh_tokens WHERE token_hash = ?`, hash,
+	).Scan(&before.TokenHash, &before.FamilyID, &before.UserID, &before.CreatedAt, &before.ExpiresAt, &usedAt, &before.Revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !token.Equal(before.TokenHash, hash) {
+		return nil, ErrNotFound
+	}
+	before.UsedAt = usedAt.Time
+
+	if !before.IsUsed() {
+		if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at = ? WHERE token_hash = ?`, time.Now().UTC(), hash); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &before, nil
+}
+
+func (s *SQLRefreshTokenStore) RevokeFamily(familyID string) error {
+	_, err := s.db.Exec(`UPDATE refresh_tokens SET revoked = TRUE WHERE family_id = ?`, familyID)
+	return err
+}
+
+func (s *SQLRefreshTokenStore) DeleteExpired() (int, error) {
+	res, err := s.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at <= ? OR revoked`, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+)
+
+const sessionColumns = `id, user_id, device, ip_address, created_at, last_seen, expires_at`
+
+// SessionStore backed by a SQL database (SQLite)
+type SQLSessionStore struct {
+	db          *sql.DB
+	idleTimeout time.Duration
+}
+
+// Sessions expire at their ExpiresAt time, or after idleTimeout without
+// activity (no idle limit when zero)
+func NewSQLSessionStore(db *sql.DB, idleTimeout time.Duration) *SQLSessionStore {
+	return &SQLSessionStore{db: db, idleTimeout: idleTimeout}
+}
+
+func (s *SQLSessionStore) Create(session *model.Session) error {
+	_, err := s.db.Exec(
+		`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.ID,
+		session.UserID,
+		session.Device,
+		session.IPAddress,
+		session.CreatedAt.UTC(),
+		session.LastSeen.UTC(),
+		session.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+func (s *SQLSessionStore) Get(id string) (*model.Session, error) {
+	session, err := scanSession(s.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.IsExpired(s.idleTimeout) {
+		return nil, ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *SQLSessionStore) Touch(id string) error {
+	now := time.Now().UTC()
+	res, err := s.db.Exec(
+		`UPDATE sessions SET last_seen = ? WHERE id = ? AND expires_at > ? AND last_seen > ?`,
+		now, id, now, s.idleCutoff(now),
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLSessionStore) Delete(id string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+func (s *SQLSessionStore) DeleteByUser(userID string) ([]string, error) {
+	rows, err := s.db.Query(`DELETE FROM sessions WHERE user_id = ? RETURNING id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *SQLSessionStore) ListByUser(userID string) ([]*model.Session, error) {
+	now := time.Now().UTC()
+	rows, err := s.db.Query(
+		`SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = ? AND expires_at > ? AND last_seen > ?
+		ORDER BY created_at`,
+		userID, now, s.idleCutoff(now),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*model.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLSessionStore) Sweep() (int, error) {
+	now := time.Now().UTC()
+	res, err := s.db.Exec(
+		`DELETE FROM sessions WHERE expires_at <= ? OR last_seen <= ?`,
+		now, s.idleCutoff(now),
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// Sessions last seen before the returned time are idle-expired
+func (s *SQLSessionStore) idleCutoff(now time.Time) time.Time {
+	if s.idleTimeout <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-s.idleTimeout)
+}
+
+func scanSession(row rowScanner) (*model.Session, error) {
+	var session model.Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastSeen,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
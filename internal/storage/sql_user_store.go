@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/automatedtomato/grpc-auth-service/internal/lockout"
+	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/token"
+	_ "modernc.org/sqlite" // pure-Go SQLite driver
+)
+
+const userColumns = `id, username, email, password_hash, created_at, reset_token_hash, reset_token_expires,
+	failed_login_attempts, last_failed_login, locked_until,
+	totp_secret, totp_enabled, totp_last_counter, recovery_code_hashes,
+	email_verified, verify_token_hash, verify_token_expires, password_changed_at,
+	roles, permissions, disabled_at, deleted_at`
+
+// UserStore backed by a SQL database (SQLite)
+type SQLUserStore struct {
+	db *sql.DB
+}
+
+// Open SQLite database at dsn and bring its schema up to date
+func OpenSQLite(dsn string) (*sql.DB, error) {
+	// Store timestamps in a sortable format so they can be compared in queries.
+	// All times are written in UTC for the same reason.
+	if strings.Contains(dsn, "?") {
+		dsn += "&_time_format=sqlite"
+	} else {
+		dsn += "?_time_format=sqlite"
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer; serialize access through one connection
+	// so concurrent handlers wait instead of failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`PRAGMA foreign_keys = ON`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func NewSQLUserStore(db *sql.DB) *SQLUserStore {
+	return &SQLUserStore{db: db}
+}
+
+func (s *SQLUserStore) Create(user *model.User) error {
+	_, err := s.db.Exec(
+		`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID,
+		user.Username,
+		user.Email,
+		user.PasswordHash,
+		user.CreatedAt.UTC(),
+		nullString(user.ResetTokenHash),
+		nullTime(user.ResetTokenExpires),
+		user.FailedLoginAttempts,
+		nullTime(user.LastFailedLogin),
+		nullTime(user.LockedUntil),
+		nullString(user.TOTPSecret),
+		user.TOTPEnabled,
+		user.TOTPLastCounter,
+		nullString(strings.Join(user.RecoveryCodeHashes, " ")),
+		user.EmailVerified,
+		nullString(user.VerifyTokenHash),
+		nullTime(user.VerifyTokenExpires),
+		nullTime(user.PasswordChangedAt),
+		nullString(strings.Join(user.Roles, " ")),
+		nullString(strings.Join(user.Permissions, " ")),
+		nullTime(user.DisabledAt),
+		nullTime(user.DeletedAt),
+	)
+	return mapConstraintError(err)
+}
+
+func (s *SQLUserStore) GetByUsername(username string) (*model.User, error) {
+	return s.getOne(`SELECT `+userColumns+` FROM users WHERE username = ?`, username)
+}
+
+func (s *SQLUserStore) GetByEmail(email string) (*model.User, error) {
+	return s.getOne(`SELECT `+userColumns+` FROM users WHERE email = ?`, email)
+}
+
+func (s *SQLUserStore) GetByID(id string) (*model.User, error) {
+	return s.getOne(`SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+func (s *SQLUserStore) GetByResetToken(raw string) (*model.User, error) {
+	user, err := s.getByTokenHash(`reset_token_hash`, raw)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Equal(user.ResetTokenHash, token.Hash(raw)) {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *SQLUserStore) GetByVerifyToken(raw string) (*model.User, error) {
+	user, err := s.getByTokenHash(`verify_token_hash`, raw)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Equal(user.VerifyTokenHash, token.Hash(raw)) {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *SQLUserStore) Update(user *model.User) error {
+	res, err := s.db.Exec(
+		`UPDATE users SET username = ?, email = ?, password_hash = ?, reset_token_hash = ?, reset_token_expires = ?,
+		failed_login_attempts = ?, last_failed_login = ?, locked_until = ?,
+		totp_secret = ?, totp_enabled = ?, totp_last_counter = ?,
+		recovery_code_hashes = ?,
+		email_verified = ?, verify_token_hash = ?, verify_token_expires = ?,
+		password_changed_at = ?, roles = ?, permissions = ?, disabled_at = ?, deleted_at = ?
+		WHERE id = ?`,
+		user.Username,
+		user.Email,
+		user.PasswordHash,
+		nullString(user.ResetTokenHash),
+		nullTime(user.ResetTokenExpires),
+		user.FailedLoginAttempts,
+		nullTime(user.LastFailedLogin),
+		nullTime(user.LockedUntil),
+		nullString(user.TOTPSecret),
+		user.TOTPEnabled,
+		user.TOTPLastCounter,
+		nullString(strings.Join(user.RecoveryCodeHashes, " ")),
+		user.EmailVerified,
+		nullString(user.VerifyTokenHash),
+		nullTime(user.VerifyTokenExpires),
+		nullTime(user.PasswordChangedAt),
+		nullString(strings.Join(user.Roles, " ")),
+		nullString(strings.Join(user.Permissions, " ")),
+		nullTime(user.DisabledAt),
+		nullTime(user.DeletedAt),
+		user.ID,
+	)
+	if err != nil {
+		return mapConstraintError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLUserStore) RecordLoginFailure(id string, policy lockout.Policy) (*model.User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Count the failure in the database rather than from a copy read
+	// earlier; the transaction keeps the lock consistent with the count
+	now := time.Now()
+	var resetBefore time.Time
+	if policy.ResetAfter > 0 {
+		resetBefore = now.Add(-policy.ResetAfter)
+	}
+	var failures int
+	err = tx.QueryRow(
+		`UPDATE users SET
+			failed_login_attempts = CASE WHEN last_failed_login < ? THEN 1 ELSE failed_login_attempts + 1 END,
+			last_failed_login = ?
+		WHERE id = ? RETURNING failed_login_attempts`,
+		nullTime(resetBefore), now.UTC(), id,
+	).Scan(&failures)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if d := policy.LockDuration(failures); d > 0 {
+		if _, err := tx.Exec(`UPDATE users SET locked_until = ? WHERE id = ?`, now.Add(d).UTC(), id); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := scanUser(tx.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *SQLUserStore) ClearLoginFailures(id string) error {
+	res, err := s.db.Exec(
+		`UPDATE users SET failed_login_attempts = 0, last_failed_login = NULL, locked_until = NULL WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLUserStore) List(filter UserFilter) ([]*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE id > ?`
+	args := []any{filter.AfterID}
+	if filter.Query != "" {
+		query += ` AND (username LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\')`
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		args = append(args, pattern, pattern)
+	}
+	if filter.Role != "" {
+		// roles is a space-separated list
+		query += ` AND ' ' || roles || ' ' LIKE ? ESCAPE '\'`
+		args = append(args, "% "+escapeLike(filter.Role)+" %")
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			query += ` AND disabled_at IS NOT NULL`
+		} else {
+			query += ` AND disabled_at IS NULL`
+		}
+	}
+	if !filter.DeletedBefore.IsZero() {
+		query += ` AND deleted_at < ?`
+		args = append(args, filter.DeletedBefore.UTC())
+	}
+	query += ` ORDER BY id`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *SQLUserStore) Delete(id string) error {
+	res, err := s.db.Exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLUserStore) getOne(query string, args ...any) (*model.User, error) {
+	user, err := scanUser(s.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+// Look up a user by the hash of raw in one of the token hash columns
+func (s *SQLUserStore) getByTokenHash(column, raw string) (*model.User, error) {
+	return s.getOne(`SELECT `+userColumns+` FROM users WHERE `+column+` = ?`, token.Hash(raw))
+}
+
+// Common interface of *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (*model.User, error) {
+	var (
+		user         model.User
+		resetHash    sql.NullString
+		resetExpires sql.NullTime
+		lastFailed   sql.NullTime
+		lockedUntil  sql.NullTime
+		totpSecret   sql.NullString
+		recovery     sql.NullString
+		verifyHash   sql.NullString
+		verifyExp    sql.NullTime
+		pwChanged    sql.NullTime
+		roles        sql.NullString
+		permissions  sql.NullString
+		disabledAt   sql.NullTime
+		deletedAt    sql.NullTime
+	)
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&resetHash,
+		&resetExpires,
+		&user.FailedLoginAttempts,
+		&lastFailed,
+		&lockedUntil,
+		&totpSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastCounter,
+		&recovery,
+		&user.EmailVerified,
+		&verifyHash,
+		&verifyExp,
+		&pwChanged,
+		&roles,
+		&permissions,
+		&disabledAt,
+		&deletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	user.ResetTokenHash = resetHash.String
+	user.ResetTokenExpires = resetExpires.Time
+	user.LastFailedLogin = lastFailed.Time
+	user.LockedUntil = lockedUntil.Time
+	user.TOTPSecret = totpSecret.String
+	user.RecoveryCodeHashes = strings.Fields(recovery.String)
+	user.VerifyTokenHash = verifyHash.String
+	user.VerifyTokenExpires = verifyExp.Time
+	user.PasswordChangedAt = pwChanged.Time
+	user.Roles = strings.Fields(roles.String)
+	user.Permissions = strings.Fields(permissions.String)
+	user.DisabledAt = disabledAt.Time
+	user.DeletedAt = deletedAt.Time
+	return &user, nil
+}
+
+// Translate unique index violations into the store's sentinel errors
+func mapConstraintError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "users.username"):
+		return ErrDuplicateUsername
+	case strings.Contains(msg, "users.email"):
+		return ErrDuplicateEmail
+	case strings.Contains(msg, "webauthn_credentials.id"):
+		return ErrDuplicateCredential
+	}
+	return err
+}
+
+// Escape LIKE wildcards in s for use with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
@@ -1,35 +1,90 @@
 package storage
 
 import (
-	"errors"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/automatedtomato/grpc-auth-service/internal/lockout"
 	"github.com/automatedtomato/grpc-auth-service/internal/model"
+	"github.com/automatedtomato/grpc-auth-service/internal/token"
 )
 
+// Lookups return ErrNotFound for unknown users; Create and Update return
+// ErrDuplicateUsername or ErrDuplicateEmail on uniqueness conflicts.
 type UserStore interface {
 	Create(user *model.User) error
 	GetByUsername(username string) (*model.User, error)
 	GetByEmail(email string) (*model.User, error)
 	GetByID(id string) (*model.User, error)
-	GetByResetToken(token string) (*model.User, error)
+	// Look up a user by raw reset token; only its hash is stored
+	GetByResetToken(raw string) (*model.User, error)
+	// Look up a user by raw email verification token; only its hash is stored
+	GetByVerifyToken(raw string) (*model.User, error)
 	Update(user *model.User) error
+	// Count a failed login against the user under policy in a single atomic
+	// step, so concurrent failures are all counted. Returns the updated user.
+	RecordLoginFailure(id string, policy lockout.Policy) (*model.User, error)
+	// Forget failed logins and lift any lock, leaving the rest of the user
+	ClearLoginFailures(id string) error
+	// Users matching filter, ordered by ID
+	List(filter UserFilter) ([]*model.User, error)
+	Delete(id string) error
+}
+
+// Selection of users for UserStore.List. Zero fields do not filter.
+type UserFilter struct {
+	// Substring of the username or email, case-insensitive
+	Query string
+	// Role the users must have
+	Role string
+	// Only disabled (true) or only enabled (false) users
+	Disabled *bool
+	// Only users deleted before this time
+	DeletedBefore time.Time
+	// Only users with IDs after this one, for paging
+	AfterID string
+	// Maximum number of users returned
+	Limit int
+}
+
+// Whether user passes every filter except AfterID and Limit
+func (f UserFilter) matches(user *model.User) bool {
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(user.Username), q) && !strings.Contains(strings.ToLower(user.Email), q) {
+			return false
+		}
+	}
+	if f.Role != "" && !user.HasRole(f.Role) {
+		return false
+	}
+	if f.Disabled != nil && user.IsDisabled() != *f.Disabled {
+		return false
+	}
+	if !f.DeletedBefore.IsZero() && (!user.IsDeleted() || !user.DeletedAt.Before(f.DeletedBefore)) {
+		return false
+	}
+	return true
 }
 
 type InMemoryUserStore struct {
-	users   map[string]*model.User
-	byName  map[string]string
-	byEmail map[string]string
-	byToken map[string]string
-	mu      sync.RWMutex
+	users    map[string]*model.User
+	byName   map[string]string
+	byEmail  map[string]string
+	byToken  map[string]string // keyed by reset token hash
+	byVerify map[string]string // keyed by verification token hash
+	mu       sync.RWMutex
 }
 
 func NewInMemoryUserStore() *InMemoryUserStore {
 	return &InMemoryUserStore{
-		users:   make(map[string]*model.User),
-		byName:  make(map[string]string),
-		byEmail: make(map[string]string),
-		byToken: make(map[string]string),
+		users:    make(map[string]*model.User),
+		byName:   make(map[string]string),
+		byEmail:  make(map[string]string),
+		byToken:  make(map[string]string),
+		byVerify: make(map[string]string),
 	}
 }
 
@@ -39,17 +94,16 @@ func (s *InMemoryUserStore) Create(user *model.User) error {
 
 	// validate uniqueness of username and email
 	if _, exists := s.byName[user.Username]; exists {
-		return errors.New("username already exists")
+		return ErrDuplicateUsername
 	}
 
 	if _, exists := s.byEmail[user.Email]; exists {
-		return errors.New("email already exists")
+		return ErrDuplicateEmail
 	}
 
 	// save user
-	s.users[user.ID] = user
-	s.byName[user.Username] = user.ID
-	s.byEmail[user.Email] = user.ID
+	s.users[user.ID] = cloneUser(user)
+	s.index(user)
 	return nil
 }
 
@@ -59,9 +113,9 @@ func (s *InMemoryUserStore) GetByUsername(username string) (*model.User, error)
 
 	id, exists := s.byName[username]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, ErrNotFound
 	}
-	return s.users[id], nil
+	return cloneUser(s.users[id]), nil
 }
 
 func (s *InMemoryUserStore) GetByEmail(email string) (*model.User, error) {
@@ -70,9 +124,9 @@ func (s *InMemoryUserStore) GetByEmail(email string) (*model.User, error) {
 
 	id, exists := s.byEmail[email]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, ErrNotFound
 	}
-	return s.users[id], nil
+	return cloneUser(s.users[id]), nil
 }
 
 func (s *InMemoryUserStore) GetByID(id string) (*model.User, error) {
@@ -81,39 +135,147 @@ func (s *InMemoryUserStore) GetByID(id string) (*model.User, error) {
 
 	user, exists := s.users[id]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, ErrNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (s *InMemoryUserStore) GetByResetToken(raw string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := token.Hash(raw)
+	id, exists := s.byToken[hash]
+	if !exists {
+		return nil, ErrNotFound
 	}
-	return user, nil
+	user := s.users[id]
+	if !token.Equal(user.ResetTokenHash, hash) {
+		return nil, ErrNotFound
+	}
+	return cloneUser(user), nil
 }
 
-func (s *InMemoryUserStore) GetByResetToken(token string) (*model.User, error) {
+func (s *InMemoryUserStore) GetByVerifyToken(raw string) (*model.User, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	id, exists := s.byToken[token]
+	hash := token.Hash(raw)
+	id, exists := s.byVerify[hash]
 	if !exists {
-		return nil, errors.New("invalid reset token")
+		return nil, ErrNotFound
+	}
+	user := s.users[id]
+	if !token.Equal(user.VerifyTokenHash, hash) {
+		return nil, ErrNotFound
 	}
-	return s.users[id], nil
+	return cloneUser(user), nil
 }
 
 func (s *InMemoryUserStore) Update(user *model.User) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.users[user.ID]; !exists {
-		return errors.New("user not found")
+	old, exists := s.users[user.ID]
+	if !exists {
+		return ErrNotFound
+	}
+
+	// validate uniqueness of a changed username or email
+	if id, exists := s.byName[user.Username]; exists && id != user.ID {
+		return ErrDuplicateUsername
+	}
+	if id, exists := s.byEmail[user.Email]; exists && id != user.ID {
+		return ErrDuplicateEmail
 	}
+	s.unindex(old)
+	s.users[user.ID] = cloneUser(user)
+	s.index(user)
+	return nil
+}
+
+func (s *InMemoryUserStore) RecordLoginFailure(id string, policy lockout.Policy) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	for token, id := range s.byToken {
-		if id == user.ID {
-			delete(s.byToken, token)
+	user, exists := s.users[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	policy.RecordFailure(user)
+	return cloneUser(user), nil
+}
+
+func (s *InMemoryUserStore) ClearLoginFailures(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return ErrNotFound
+	}
+	user.ClearLockout()
+	return nil
+}
+
+func (s *InMemoryUserStore) List(filter UserFilter) ([]*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []*model.User
+	for id, user := range s.users {
+		if id > filter.AfterID && filter.matches(user) {
+			users = append(users, cloneUser(user))
 		}
 	}
-	if user.ResetToken != "" {
-		s.byToken[user.ResetToken] = user.ID
+	slices.SortFunc(users, func(a, b *model.User) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
 	}
+	return users, nil
+}
 
-	s.users[user.ID] = user
+func (s *InMemoryUserStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return ErrNotFound
+	}
+	delete(s.users, id)
+	s.unindex(user)
 	return nil
 }
+
+// Copy of user that shares no slices with it, so callers never see or
+// change the stored user
+func cloneUser(user *model.User) *model.User {
+	copied := *user
+	copied.Roles = slices.Clone(user.Roles)
+	copied.Permissions = slices.Clone(user.Permissions)
+	copied.RecoveryCodeHashes = slices.Clone(user.RecoveryCodeHashes)
+	return &copied
+}
+
+// Add the lookup keys of user. Caller must hold s.mu.
+func (s *InMemoryUserStore) index(user *model.User) {
+	s.byName[user.Username] = user.ID
+	s.byEmail[user.Email] = user.ID
+	if user.ResetTokenHash != "" {
+		s.byToken[user.ResetTokenHash] = user.ID
+	}
+	if user.VerifyTokenHash != "" {
+		s.byVerify[user.VerifyTokenHash] = user.ID
+	}
+}
+
+// Remove the lookup keys of the stored record user. Caller must hold s.mu.
+func (s *InMemoryUserStore) unindex(user *model.User) {
+	delete(s.byName, user.Username)
+	delete(s.byEmail, user.Email)
+	delete(s.byToken, user.ResetTokenHash)
+	delete(s.byVerify, user.VerifyTokenHash)
+}
@@ -0,0 +1,80 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// Default token entropy in bytes (256 bits)
+const DefaultBytes = 32
+
+// Generate a URL-safe random token carrying n bytes of entropy
+func New(n int) string {
+	b := make([]byte, n)
+	read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Generate an RFC 9562 UUIDv7: a 48-bit millisecond timestamp followed by
+// random bits, so IDs sort by creation time
+func NewUUIDv7() string {
+	var u [16]byte
+	read(u[6:])
+
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(u[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(u[2:6], uint32(ms))
+	u[6] = (u[6] & 0x0f) | 0x70 // version 7
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 9562 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// Alphabet of codes people type in: no 0/O or 1/I look-alikes, and 32
+// characters so each one carries exactly 5 random bits
+const codeAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// Generate a random code of n characters meant to be read and typed by people
+func NewCode(n int) string {
+	b := make([]byte, n)
+	read(b)
+	for i := range b {
+		b[i] = codeAlphabet[b[i]&31]
+	}
+	return string(b)
+}
+
+// Fill b from the system CSPRNG. A failing CSPRNG leaves no safe way to
+// continue, so this panics rather than handing out weak tokens.
+func read(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic("token: crypto/rand failed: " + err.Error())
+	}
+}
+
+// SHA-256 digest of a token, hex encoded. Only digests are persisted, so a
+// leaked store does not hand out usable tokens.
+func Hash(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
+
+// Compare two token digests in constant time
+func Equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,101 @@
+package token
+
+import (
+	"encoding/base64"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestNewLength(t *testing.T) {
+	for _, n := range []int{16, DefaultBytes, 64} {
+		tok := New(n)
+		raw, err := base64.RawURLEncoding.DecodeString(tok)
+		if err != nil {
+			t.Fatalf("New(%d) = %q is not URL-safe base64: %v", n, tok, err)
+		}
+		if len(raw) != n {
+			t.Errorf("New(%d) decoded to %d bytes", n, len(raw))
+		}
+	}
+}
+
+var uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewUUIDv7Format(t *testing.T) {
+	id := NewUUIDv7()
+	if !uuidV7Pattern.MatchString(id) {
+		t.Fatalf("NewUUIDv7() = %q, not a version 7 UUID", id)
+	}
+}
+
+func TestNewUUIDv7Ordering(t *testing.T) {
+	// The timestamp prefix has millisecond resolution, so compare only the prefix
+	prev := NewUUIDv7()
+	for i := 0; i < 1000; i++ {
+		next := NewUUIDv7()
+		if next[:13] < prev[:13] {
+			t.Fatalf("timestamp went backwards: %q after %q", next, prev)
+		}
+		prev = next
+	}
+}
+
+func TestConcurrentUniqueness(t *testing.T) {
+	const (
+		goroutines = 32
+		perWorker  = 2000
+	)
+
+	generators := map[string]func() string{
+		"New":       func() string { return New(DefaultBytes) },
+		"NewUUIDv7": NewUUIDv7,
+	}
+
+	for name, generate := range generators {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mu   sync.Mutex
+				seen = make(map[string]struct{}, goroutines*perWorker)
+				wg   sync.WaitGroup
+			)
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					local := make([]string, perWorker)
+					for i := range local {
+						local[i] = generate()
+					}
+
+					mu.Lock()
+					defer mu.Unlock()
+					for _, v := range local {
+						if _, dup := seen[v]; dup {
+							t.Errorf("duplicate value %q", v)
+						}
+						seen[v] = struct{}{}
+					}
+				}()
+			}
+			wg.Wait()
+
+			if len(seen) != goroutines*perWorker {
+				t.Errorf("got %d unique values, want %d", len(seen), goroutines*perWorker)
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	tok := New(DefaultBytes)
+	if Hash(tok) == tok {
+		t.Fatal("Hash returned the token itself")
+	}
+	if !Equal(Hash(tok), Hash(tok)) {
+		t.Error("Hash is not deterministic")
+	}
+	if Equal(Hash(tok), Hash(New(DefaultBytes))) {
+		t.Error("different tokens produced equal hashes")
+	}
+}
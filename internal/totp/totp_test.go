@@ -0,0 +1,94 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// ASCII "12345678901234567890", the SHA-1 seed of the RFC 6238 test vectors
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 Appendix B, SHA-1. The RFC lists 8-digit values; 6-digit codes
+// are their last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeAtRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := CodeAt(rfcSecret, Counter(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("code at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		at := time.Unix(v.unix, 0)
+		counter, ok := Validate(rfcSecret, v.code, at, 0)
+		if !ok {
+			t.Errorf("code %s rejected at %d", v.code, v.unix)
+			continue
+		}
+		if counter != Counter(at) {
+			t.Errorf("code %s matched counter %d, want %d", v.code, counter, Counter(at))
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Counter(now)
+	code := func(counter int64) string {
+		c, err := CodeAt(rfcSecret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	for _, tc := range []struct {
+		offset int64
+		skew   int
+		ok     bool
+	}{
+		{0, 0, true},
+		{-1, 0, false},
+		{1, 0, false},
+		{-1, 1, true},
+		{1, 1, true},
+		{-2, 1, false},
+		{2, 1, false},
+		{2, 2, true},
+	} {
+		counter, ok := Validate(rfcSecret, code(step+tc.offset), now, tc.skew)
+		if ok != tc.ok {
+			t.Errorf("offset %d with skew %d: accepted = %v, want %v", tc.offset, tc.skew, ok, tc.ok)
+			continue
+		}
+		if ok && counter != step+tc.offset {
+			t.Errorf("offset %d with skew %d: matched counter %d, want %d", tc.offset, tc.skew, counter, step+tc.offset)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870821", "94287082"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Errorf("malformed code %q accepted", code)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	authpb "github.com/automatedtomato/grpc-auth-service/api/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Path prefix of AuthService methods, shared with gRPC-Web
+const authServicePrefix = "/auth.AuthService/"
+
+// Largest JSON request body accepted
+const maxRequestBytes = 1 << 20
+
+// Metadata key carrying the browser's IP address to the gRPC server
+const forwardedForKey = "x-forwarded-for"
+
+// Calls AuthService methods on behalf of the browser client, which posts
+// plain JSON (snake_case field names) to /auth.AuthService/<Method>.
+// WebAuthn ceremonies need this since the browser APIs hand out JSON.
+type jsonGateway struct {
+	conn    *grpc.ClientConn
+	service protoreflect.ServiceDescriptor
+}
+
+func newJSONGateway(conn *grpc.ClientConn) *jsonGateway {
+	return &jsonGateway{
+		conn:    conn,
+		service: authpb.File_api_proto_auth_proto.Services().ByName("AuthService"),
+	}
+}
+
+func (g *jsonGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, authServicePrefix)
+	method := g.service.Methods().ByName(protoreflect.Name(name))
+	if method == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	req, err := newMessage(method.Input())
+	if err != nil {
+		writeError(w, status.New(codes.Internal, "unknown request type"))
+		return
+	}
+	resp, err := newMessage(method.Output())
+	if err != nil {
+		writeError(w, status.New(codes.Internal, "unknown response type"))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		writeError(w, status.New(codes.InvalidArgument, "failed to read request"))
+		return
+	}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, req.Interface()); err != nil {
+		writeError(w, status.New(codes.InvalidArgument, "invalid JSON request"))
+		return
+	}
+
+	if err := g.conn.Invoke(forwardClientIP(r), authServicePrefix+name, req.Interface(), resp.Interface()); err != nil {
+		writeError(w, status.Convert(err))
+		return
+	}
+
+	out, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(resp.Interface())
+	if err != nil {
+		writeError(w, status.New(codes.Internal, "failed to encode response"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// Context of r passing the client's IP address on to the gRPC server, which
+// uses it in place of the proxy's address when the proxy is listed in its
+// -trusted-proxies
+func forwardClientIP(r *http.Request) context.Context {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return metadata.AppendToOutgoingContext(r.Context(), forwardedForKey, host)
+}
+
+func newMessage(desc protoreflect.MessageDescriptor) (protoreflect.Message, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName())
+	if err != nil {
+		return nil, err
+	}
+	return mt.New(), nil
+}
+
+// Write a failed call in the shape of the service's responses, so the page
+// can keep checking "success" and "message"
+func writeError(w http.ResponseWriter, st *status.Status) {
+	httpStatus := http.StatusInternalServerError
+	switch st.Code() {
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		httpStatus = http.StatusBadRequest
+	case codes.Unauthenticated:
+		httpStatus = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		httpStatus = http.StatusForbidden
+	case codes.NotFound:
+		httpStatus = http.StatusNotFound
+	case codes.AlreadyExists:
+		httpStatus = http.StatusConflict
+	case codes.ResourceExhausted:
+		httpStatus = http.StatusTooManyRequests
+	case codes.Unavailable:
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"success": false,
+		"message": st.Message(),
+		"code":    st.Code().String(),
+	}); err != nil {
+		log.Printf("Failed to write error response: %v", err)
+	}
+}
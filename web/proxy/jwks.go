@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	authpb "github.com/automatedtomato/grpc-auth-service/api/proto"
+	"github.com/automatedtomato/grpc-auth-service/internal/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Path of the JSON Web Key Set, where token verifiers look for it
+const jwksPath = "/.well-known/jwks.json"
+
+// Serves the server's token verification keys as a JWK Set document
+type jwksHandler struct {
+	client authpb.AuthServiceClient
+}
+
+func newJWKSHandler(conn *grpc.ClientConn) *jwksHandler {
+	return &jwksHandler{client: authpb.NewAuthServiceClient(conn)}
+}
+
+func (h *jwksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, err := h.client.GetJWKS(forwardClientIP(r), &authpb.GetJWKSRequest{})
+	if err != nil {
+		writeError(w, status.Convert(err))
+		return
+	}
+
+	set := struct {
+		Keys []jwt.JWK `json:"keys"`
+	}{Keys: []jwt.JWK{}}
+	for _, k := range resp.Keys {
+		set.Keys = append(set.Keys, jwt.JWK{
+			Kty: k.Kty,
+			Kid: k.Kid,
+			Use: k.Use,
+			Alg: k.Alg,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Crv,
+			X:   k.X,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwt.JWKSMaxAge.Seconds())))
+	if err := json.NewEncoder(w).Encode(set); err != nil {
+		log.Printf("Failed to write key set: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"google.golang.org/grpc"
@@ -51,12 +52,22 @@ func main() {
 	// Static file handler
 	fileServer := http.FileServer(http.Dir(*staticDir))
 
+	// JSON handler for the browser client
+	gateway := newJSONGateway(conn)
+
+	// Public keys for services verifying access tokens
+	http.Handle(jwksPath, newJWKSHandler(conn))
+
 	// HTTP handler
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if grpcWebServer.IsGrpcWebRequest(r) || grpcWebServer.IsAcceptableGrpcCorsRequest(r) {
 			grpcWebServer.ServeHTTP(w, r)
 			return
 		}
+		if strings.HasPrefix(r.URL.Path, authServicePrefix) {
+			gateway.ServeHTTP(w, r)
+			return
+		}
 		fileServer.ServeHTTP(w, r)
 	})
 